@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// Album sizes the WhatsApp apps allow: fewer than two items is just a media
+// message, and the picker stops at 30.
+const (
+	minAlbumItems = 2
+	maxAlbumItems = 30
+)
+
+// albumItem is a file of an album, read and checked before connecting.
+type albumItem struct {
+	path string
+	kind string
+	data []byte
+}
+
+// readAlbumItems loads the files of an album, telling images from videos by
+// their MIME type.
+func readAlbumItems(paths []string, force bool) ([]albumItem, error) {
+	items := make([]albumItem, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %v", err)
+		}
+		item := albumItem{path: path, data: data}
+		switch mimeType := mimeTypeFor(path, data); {
+		case strings.HasPrefix(mimeType, "image/"):
+			item.kind = mediaImage
+		case strings.HasPrefix(mimeType, "video/"):
+			item.kind = mediaVideo
+		default:
+			return nil, fmt.Errorf("%s is %s; albums can only hold images and videos", filepath.Base(path), mimeType)
+		}
+		if !force {
+			if err := checkMediaSize(item.kind, path); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// albumMessage is the parent message announcing how many items follow.
+func albumMessage(items []albumItem) *waE2E.Message {
+	var images, videos uint32
+	for _, item := range items {
+		if item.kind == mediaImage {
+			images++
+		} else {
+			videos++
+		}
+	}
+	return &waE2E.Message{AlbumMessage: &waE2E.AlbumMessage{
+		ExpectedImageCount: proto.Uint32(images),
+		ExpectedVideoCount: proto.Uint32(videos),
+	}}
+}
+
+// associateWithAlbum marks msg as an item of the album sent as parentID, so
+// it is shown inside the album instead of on its own.
+func associateWithAlbum(msg *waE2E.Message, chat, parentID string) {
+	msg.MessageContextInfo = &waE2E.MessageContextInfo{
+		MessageAssociation: &waE2E.MessageAssociation{
+			AssociationType: waE2E.MessageAssociation_MEDIA_ALBUM.Enum(),
+			ParentMessageKey: &waCommon.MessageKey{
+				RemoteJID: proto.String(chat),
+				FromMe:    proto.Bool(true),
+				ID:        proto.String(parentID),
+			},
+		},
+	}
+}
+
+func sendAlbum(ctx context.Context, args []string) error {
+	fs := newFlagSet("send-album")
+	caption := fs.String("caption", "", "caption to show under the first item")
+	force := fs.Bool("force", false, "send even if a file is over WhatsApp's size limit")
+	retries := bindSetting(fs, uploadRetriesSetting)
+	args = parseCommandFlags(fs, args, retries)
+
+	if len(args) < 1+minAlbumItems {
+		fmt.Println("Usage: send-album <recipient> <path1> <path2> [path...] [--caption <text>]")
+		return errUsage
+	}
+	if n := len(args) - 1; n > maxAlbumItems {
+		return fmt.Errorf("an album holds at most %d items, got %d", maxAlbumItems, n)
+	}
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return err
+	}
+	if err := applyUploadRetries(); err != nil {
+		return err
+	}
+
+	items, err := readAlbumItems(args[1:], *force)
+	if err != nil {
+		return err
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	to, err := client.ResolveRecipient(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Upload everything first, so a failed upload doesn't leave a
+	// half-empty album in the chat
+	messages := make([]*waE2E.Message, len(items))
+	for i, item := range items {
+		itemCaption := ""
+		if i == 0 {
+			itemCaption = *caption
+		}
+		if messages[i], err = buildMediaMessage(ctx, client, item.kind, item.path, item.data, itemCaption, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Uploaded %d/%d: %s\n", i+1, len(items), filepath.Base(item.path))
+	}
+
+	parent, err := client.SendMessage(ctx, to, albumMessage(items))
+	if err != nil {
+		return withExitCode(exitSendFailure, fmt.Errorf("failed to send album: %v", err))
+	}
+	for i, msg := range messages {
+		associateWithAlbum(msg, to.String(), parent.ID)
+		if _, err := client.SendMessage(ctx, to, msg); err != nil {
+			return withExitCode(exitSendFailure, fmt.Errorf("failed to send album item %d (%s), %d of %d sent: %v", i+1, filepath.Base(items[i].path), i, len(items), err))
+		}
+	}
+
+	fmt.Printf("Album of %d items sent to %s (ID: %s, Time: %s)\n", len(items), to.String(), parent.ID, parent.Timestamp.Local().Format("2006-01-02 15:04:05"))
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// printAppStateEvent prints a one-line summary of an app-state change made
+// from another device (contact renames, pinned/muted/archived chats and
+// deletions).
+func printAppStateEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Contact:
+		fmt.Printf("[AppState] Contact %s updated: %q\n", formatJID(v.JID), v.Action.GetFullName())
+	case *events.PushName:
+		fmt.Printf("[AppState] Push name of %s changed: %q -> %q\n", formatJID(v.JID), v.OldPushName, v.NewPushName)
+	case *events.Pin:
+		state := "unpinned"
+		if v.Action.GetPinned() {
+			state = "pinned"
+		}
+		fmt.Printf("[AppState] Chat %s %s\n", formatJID(v.JID), state)
+	case *events.Mute:
+		if v.Action.GetMuted() {
+			until := "forever"
+			if end := v.Action.GetMuteEndTimestamp(); end > 0 {
+				until = "until " + time.UnixMilli(end).Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("[AppState] Chat %s muted %s\n", formatJID(v.JID), until)
+		} else {
+			fmt.Printf("[AppState] Chat %s unmuted\n", formatJID(v.JID))
+		}
+	case *events.Archive:
+		state := "unarchived"
+		if v.Action.GetArchived() {
+			state = "archived"
+		}
+		fmt.Printf("[AppState] Chat %s %s\n", formatJID(v.JID), state)
+	case *events.DeleteForMe:
+		fmt.Printf("[AppState] Message %s in %s deleted for me\n", v.MessageID, formatJID(v.ChatJID))
+	case *events.ClearChat:
+		fmt.Printf("[AppState] Chat %s cleared\n", formatJID(v.JID))
+	case *events.DeleteChat:
+		fmt.Printf("[AppState] Chat %s deleted\n", formatJID(v.JID))
+	}
+}
+
+// resyncAppState throws away the stored version of every app-state
+// collection and fetches it again from a snapshot, for when contacts or chat
+// settings are missing because the initial sync didn't complete.
+func resyncAppState(args []string) error {
+	parseCommandFlags(newFlagSet("resync-appstate"), args)
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	synced := make(chan appstate.WAPatchName, len(appstate.AllPatchNames))
+	handlerID := client.AddEventHandler(func(evt interface{}) {
+		if v, ok := evt.(*events.AppStateSyncComplete); ok {
+			select {
+			case synced <- v.Name:
+			default:
+			}
+		}
+	})
+	defer client.RemoveEventHandler(handlerID)
+
+	failed := 0
+	for _, name := range appstate.AllPatchNames {
+		fmt.Printf("Resyncing %s...\n", name)
+		if err := client.FetchAppState(name, true, false); err != nil {
+			fmt.Printf("  failed: %v\n", err)
+			failed++
+			continue
+		}
+
+		if err := waitForSyncComplete(synced, name); err != nil {
+			fmt.Printf("  %v\n", err)
+			failed++
+			continue
+		}
+		version, _, _ := client.Store.AppState.GetAppStateVersion(string(name))
+		fmt.Printf("  done (version %d)\n", version)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d app state collections failed to resync", failed, len(appstate.AllPatchNames))
+	}
+	fmt.Println("App state resync complete")
+	return nil
+}
+
+// waitForSyncComplete waits for the AppStateSyncComplete event of name,
+// skipping any left over from other collections.
+func waitForSyncComplete(synced <-chan appstate.WAPatchName, name appstate.WAPatchName) error {
+	timeout := time.After(appStateSyncTimeout)
+	for {
+		select {
+		case got := <-synced:
+			if got == name {
+				return nil
+			}
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for %s to finish syncing", name)
+		}
+	}
+}
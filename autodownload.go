@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// autoDownloadOptions controls saving received media in the listener.
+// Nothing is downloaded unless dir is set.
+type autoDownloadOptions struct {
+	dir     string
+	maxSize int64
+	images  bool
+	videos  bool
+	audio   bool
+	docs    bool
+	// thumbnailsOnly saves the JPEG preview embedded in the message
+	// instead of downloading the media
+	thumbnailsOnly bool
+	// nameTemplate names saved files, see downloadPlaceholders
+	nameTemplate string
+	// onExists is what to do when the name is taken: rename, skip or
+	// overwrite
+	onExists string
+	// retries asks for expired media to be uploaded again, if set
+	retries *mediaRetrier
+	// redact masks the names of saved files in what is printed, since
+	// they can be the sender's document names (--redact)
+	redact bool
+}
+
+// downloadPlaceholders are the fields --download-name can use, written in
+// braces like the placeholders of message templates.
+var downloadPlaceholders = []string{"id", "chat", "sender", "type", "timestamp", "date", "filename", "ext"}
+
+// unsafeNameChars are replaced in values put into file names: path
+// separators, and what Windows refuses, which includes the colon of device
+// JIDs like 1234:5@s.whatsapp.net.
+var unsafeNameChars = regexp.MustCompile(`[/\\:*?"<>|\x00-\x1f]`)
+
+func sanitizeFileName(s string) string {
+	s = unsafeNameChars.ReplaceAllString(s, "_")
+	if s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+func (o *autoDownloadOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.dir, "download-dir", "", "save received media to this directory (default: don't download)")
+	fs.Int64Var(&o.maxSize, "max-download-size", 0, "skip media larger than this many bytes (0 = no limit)")
+	fs.BoolVar(&o.images, "download-images", false, "download images and stickers (default: all types if no --download-* type is given)")
+	fs.BoolVar(&o.videos, "download-videos", false, "download videos")
+	fs.BoolVar(&o.audio, "download-audio", false, "download audio and voice messages")
+	fs.BoolVar(&o.docs, "download-docs", false, "download documents")
+	fs.BoolVar(&o.thumbnailsOnly, "thumbnails-only", false, "save the small embedded JPEG preview of images, videos and documents instead of the media")
+	fs.StringVar(&o.nameTemplate, "download-name", "", "file name template under --download-dir, e.g. {date}/{timestamp}_{chat}_{id}.{ext}; fields: {"+strings.Join(downloadPlaceholders, "}, {")+"} (default: <id>.<ext>, or <id>-<file name> for documents)")
+	fs.StringVar(&o.onExists, "on-exists", "rename", "when a file name is taken: rename (append (1), (2)...), skip or overwrite")
+}
+
+func (o *autoDownloadOptions) validate() error {
+	if o.dir == "" {
+		if o.maxSize != 0 || o.images || o.videos || o.audio || o.docs || o.thumbnailsOnly || o.nameTemplate != "" {
+			return fmt.Errorf("--max-download-size, --thumbnails-only, --download-name and --download-* need --download-dir")
+		}
+		return nil
+	}
+	if o.maxSize < 0 {
+		return fmt.Errorf("--max-download-size must not be negative")
+	}
+	switch o.onExists {
+	case "rename", "skip", "overwrite":
+	default:
+		return fmt.Errorf("invalid --on-exists %q: must be rename, skip or overwrite", o.onExists)
+	}
+	if o.nameTemplate != "" {
+		for _, field := range placeholderPattern.FindAllString(o.nameTemplate, -1) {
+			if !slices.Contains(downloadPlaceholders, strings.Trim(field, "{}")) {
+				return fmt.Errorf("unknown field %s in --download-name (want {%s})", field, strings.Join(downloadPlaceholders, "}, {"))
+			}
+		}
+		// Fields can't add separators, so only the template itself could
+		// point outside the download directory
+		clean := filepath.Clean(filepath.FromSlash(o.nameTemplate))
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("--download-name must stay inside --download-dir")
+		}
+	}
+	return os.MkdirAll(o.dir, 0755)
+}
+
+// wants reports whether messages of type msgType should be downloaded.
+func (o *autoDownloadOptions) wants(msgType string) bool {
+	all := !o.images && !o.videos && !o.audio && !o.docs
+	switch msgType {
+	case whatsappclient.TypeImage, whatsappclient.TypeSticker:
+		return all || o.images
+	case whatsappclient.TypeVideo:
+		return all || o.videos
+	case whatsappclient.TypeAudio, whatsappclient.TypeVoice:
+		return all || o.audio
+	case whatsappclient.TypeDocument:
+		return all || o.docs
+	}
+	return false
+}
+
+// download saves the media of msg if its type is enabled and it is within
+// the size limit. It blocks for the length of the download, so the
+// listener runs it in its own goroutine.
+func (o *autoDownloadOptions) download(m messenger, msg whatsappclient.Event) {
+	if o.dir == "" || !o.wants(msg.Type) {
+		return
+	}
+	if o.thumbnailsOnly {
+		o.saveThumbnail(msg)
+		return
+	}
+
+	media, mimeType, fileName, err := downloadableFrom(msg.Raw.Message)
+	if err != nil {
+		return
+	}
+
+	// Check the advertised size first so large files are never fetched
+	var size int64
+	if sized, ok := media.(interface{ GetFileLength() uint64 }); ok {
+		size = int64(sized.GetFileLength())
+	}
+	if o.maxSize > 0 && size > o.maxSize {
+		fmt.Printf("[Download] Skipped %s %s from %s: over --max-download-size (%s)\n", formatSize(size), msg.Type, senderLabel(msg), formatSize(o.maxSize))
+		return
+	}
+
+	data, err := m.Download(media)
+	if isMediaExpired(err) {
+		if o.retries.request(msg, media.GetMediaKey()) {
+			fmt.Printf("[Download] Media of message %s has expired, asking the sender's phone to upload it again\n", msg.ID)
+		} else {
+			fmt.Printf("[Download] Media of message %s has expired\n", msg.ID)
+		}
+		return
+	} else if err != nil {
+		fmt.Printf("[Download] Failed to download message %s: %v\n", msg.ID, err)
+		return
+	}
+	o.saveMedia(msg, data, mimeType, fileName)
+}
+
+// saveMedia writes the downloaded media of msg to the download directory.
+func (o *autoDownloadOptions) saveMedia(msg whatsappclient.Event, data []byte, mimeType, fileName string) {
+	path, err := o.save(o.fileName(msg, extensionFor(mimeType), fileName), data)
+	if err != nil {
+		fmt.Printf("[Download] Failed to save %s: %v\n", msg.ID, o.shownError(err))
+		return
+	} else if path == "" {
+		return
+	}
+	fmt.Printf("[Download] Saved %s %s to %s\n", formatSize(int64(len(data))), msg.Type, o.shownPath(path))
+}
+
+// fileName names the file msg's media is saved as, relative to the download
+// directory. ext has its leading dot, and origName is the sender's name for
+// a document.
+func (o *autoDownloadOptions) fileName(msg whatsappclient.Event, ext, origName string) string {
+	if ext == "" {
+		ext = filepath.Ext(origName)
+	}
+	origName = filepath.Base(origName)
+	if origName == "." || origName == string(filepath.Separator) {
+		origName = ""
+	}
+
+	if o.nameTemplate == "" {
+		// Prefix the ID so documents sharing a name don't overwrite each other
+		if origName != "" {
+			return msg.ID + "-" + sanitizeFileName(origName)
+		}
+		return msg.ID + ext
+	}
+
+	if origName == "" {
+		origName = msg.ID + ext
+	}
+	values := map[string]string{
+		"id":        msg.ID,
+		"chat":      msg.Chat.String(),
+		"sender":    msg.Sender.String(),
+		"type":      msg.Type,
+		"timestamp": msg.Timestamp.Local().Format("20060102-150405"),
+		"date":      msg.Timestamp.Local().Format("2006-01-02"),
+		"filename":  origName,
+		"ext":       strings.TrimPrefix(ext, "."),
+	}
+	name := placeholderPattern.ReplaceAllStringFunc(o.nameTemplate, func(field string) string {
+		return sanitizeFileName(values[strings.Trim(field, "{}")])
+	})
+	return filepath.FromSlash(name)
+}
+
+// save writes data to name in the download directory, going by --on-exists
+// if the name is taken. Files are created exclusively, so downloads running
+// side by side can't claim the same name. It returns the path written, or ""
+// if the file was skipped.
+func (o *autoDownloadOptions) save(name string, data []byte) (string, error) {
+	path := filepath.Join(o.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if o.onExists == "overwrite" {
+		return path, os.WriteFile(path, data, 0644)
+	}
+
+	written, err := writeExclusive(path, data, o.onExists != "skip")
+	if errors.Is(err, os.ErrExist) {
+		fmt.Printf("[Download] Skipped %s: already exists\n", o.shownPath(path))
+		return "", nil
+	}
+	return written, err
+}
+
+// shownPath is path as printed: with redact the file name is masked, leaving
+// the directory.
+func (o *autoDownloadOptions) shownPath(path string) string {
+	if !o.redact {
+		return path
+	}
+	return filepath.Join(filepath.Dir(path), "[REDACTED]")
+}
+
+// shownError is err as printed, with the path of a file error masked like
+// shownPath.
+func (o *autoDownloadOptions) shownError(err error) error {
+	var pathErr *os.PathError
+	if !o.redact || !errors.As(err, &pathErr) {
+		return err
+	}
+	return fmt.Errorf("%s %s: %v", pathErr.Op, o.shownPath(pathErr.Path), pathErr.Err)
+}
+
+// writeExclusive writes data to a new file at path and returns the path
+// written. If path is taken it goes on to "name (1).ext", "name (2).ext" and
+// so on, or without rename returns an os.ErrExist error. Creating the file
+// exclusively means an existing file is never overwritten, even by a
+// download racing this one.
+func writeExclusive(path string, data []byte, rename bool) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) && rename {
+			path = fmt.Sprintf("%s (%d)%s", base, n, ext)
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// saveThumbnail writes the JPEG preview that image, video and document
+// messages carry inline, which needs no network request. Audio and stickers
+// have none.
+func (o *autoDownloadOptions) saveThumbnail(msg whatsappclient.Event) {
+	m := msg.Raw.Message
+	var thumbnail []byte
+	if img := m.GetImageMessage(); img != nil {
+		thumbnail = img.GetJPEGThumbnail()
+	} else if video := m.GetVideoMessage(); video != nil {
+		thumbnail = video.GetJPEGThumbnail()
+	} else if doc := m.GetDocumentMessage(); doc != nil {
+		thumbnail = doc.GetJPEGThumbnail()
+	}
+	if len(thumbnail) == 0 {
+		return
+	}
+
+	name := msg.ID + "-thumb.jpg"
+	if o.nameTemplate != "" {
+		name = o.fileName(msg, ".jpg", "")
+	}
+	path, err := o.save(name, thumbnail)
+	if err != nil {
+		fmt.Printf("[Download] Failed to save %s: %v\n", msg.ID, o.shownError(err))
+		return
+	} else if path == "" {
+		return
+	}
+	fmt.Printf("[Download] Saved %s thumbnail (%d bytes) to %s\n", msg.Type, len(thumbnail), o.shownPath(path))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// backupDir resolves --backup-dir for the database at dbPath.
+func backupDir(dbPath string) string {
+	if clientOptions.BackupDir != "" {
+		return clientOptions.BackupDir
+	}
+	return whatsappclient.DefaultBackupDir(dbPath)
+}
+
+// backupBeforeChange copies the database at dbPath before a command
+// rewrites it. There is nothing to keep if it doesn't exist yet.
+func backupBeforeChange(dbPath string) error {
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return nil
+	}
+	backup, err := whatsappclient.BackupDB(dbPath, backupDir(dbPath))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s\n", dbPath, backup)
+	return nil
+}
+
+func restoreBackup(args []string) error {
+	args = parseCommandFlags(newFlagSet("restore-backup"), args)
+
+	if len(args) != 1 {
+		fmt.Println("Usage: restore-backup <file>")
+		return errUsage
+	}
+
+	if _, err := os.Stat(args[0]); err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+
+	dbPath, err := whatsappclient.ResolveDBPath(clientOptions.DBPath)
+	if err != nil {
+		return err
+	}
+	// Restoring is a risky change too, so it can be undone the same way
+	if err := backupBeforeChange(dbPath); err != nil {
+		return err
+	}
+	if err := whatsappclient.RestoreDB(args[0], dbPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s from %s\n", dbPath, args[0])
+	fmt.Println("Stop any other command using this database before connecting again.")
+	return nil
+}
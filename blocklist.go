@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+func printBlocklist(blocklist *types.Blocklist) {
+	if len(blocklist.JIDs) == 0 {
+		fmt.Println("Blocklist is empty")
+		return
+	}
+	fmt.Printf("Blocked contacts (%d):\n", len(blocklist.JIDs))
+	for _, jid := range blocklist.JIDs {
+		fmt.Printf("  %s\n", jid.String())
+	}
+}
+
+// printBlocklistEvent prints blocks and unblocks made on another device.
+// When WhatsApp only says the list was modified, the whole list is fetched
+// again, so this blocks on a query and the listener runs it in its own
+// goroutine.
+func printBlocklistEvent(client *whatsappclient.Client, v *events.Blocklist) {
+	for _, change := range v.Changes {
+		fmt.Printf("[Blocklist] %s %sed\n", formatJID(change.JID), change.Action)
+	}
+	if v.Action != events.BlocklistActionModify {
+		return
+	}
+
+	blocklist, err := client.GetBlocklist()
+	if err != nil {
+		fmt.Printf("[Blocklist] Changed, but failed to fetch it: %v\n", err)
+		return
+	}
+	jids := make([]string, len(blocklist.JIDs))
+	for i, jid := range blocklist.JIDs {
+		jids[i] = formatJID(jid)
+	}
+	fmt.Printf("[Blocklist] Changed, now %d blocked: %s\n", len(jids), strings.Join(jids, ", "))
+}
+
+// updateBlocklist implements the block and unblock commands.
+func updateBlocklist(action events.BlocklistChangeAction, args []string) error {
+	args = parseCommandFlags(newFlagSet(string(action)), args)
+
+	if len(args) != 1 {
+		fmt.Printf("Usage: %s <jid>\n", action)
+		return errUsage
+	}
+
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return err
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	jid, err := client.ResolveRecipient(args[0])
+	if err != nil {
+		return err
+	}
+
+	blocklist, err := client.UpdateBlocklist(jid, action)
+	if err != nil {
+		return fmt.Errorf("failed to %s %s: %v", action, jid.String(), err)
+	}
+
+	fmt.Printf("Successfully %sed %s\n", action, jid.String())
+	printBlocklist(blocklist)
+	return nil
+}
+
+func showBlocklist(args []string) error {
+	parseCommandFlags(newFlagSet("blocklist"), args)
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	blocklist, err := client.GetBlocklist()
+	if err != nil {
+		return fmt.Errorf("failed to get blocklist: %v", err)
+	}
+
+	printBlocklist(blocklist)
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// botCommand builds the reply to a bot command; args is the text after the
+// command name.
+type botCommand func(msg whatsappclient.Event, args string) string
+
+// botCommands are the auto-replies enabled by --reply-prefix, keyed by
+// command name without the prefix.
+var botCommands = map[string]botCommand{
+	"ping": func(whatsappclient.Event, string) string {
+		return "pong"
+	},
+	"time": func(whatsappclient.Event, string) string {
+		return time.Now().Format("2006-01-02 15:04:05 MST")
+	},
+}
+
+// handleBotCommand replies to a text message that starts with prefix and
+// names a known command. Messages sent from this account are ignored so the
+// bot never answers on the user's behalf.
+func handleBotCommand(ctx context.Context, client *whatsappclient.Client, prefix string, msg whatsappclient.Event) {
+	if msg.IsFromMe || msg.Type != whatsappclient.TypeText || !strings.HasPrefix(msg.Content, prefix) {
+		return
+	}
+
+	name, args := cutField(strings.TrimPrefix(msg.Content, prefix))
+	command, ok := botCommands[strings.ToLower(name)]
+	if !ok {
+		return
+	}
+
+	reply := &waE2E.Message{Conversation: proto.String(command(msg, args))}
+	if _, err := client.SendMessage(ctx, msg.Chat, reply); err != nil {
+		fmt.Printf("Error replying to %s%s: %v\n", prefix, name, err)
+		return
+	}
+	fmt.Printf("[Bot] Replied to %s%s in %s\n", prefix, name, formatJID(msg.Chat))
+}
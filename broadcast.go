@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// WhatsApp's own broadcast lists live on the phone and aren't reachable
+// through the linked-device protocol, so these are kept locally in the
+// session database. Sending to one is a send to each member, who gets it
+// as a private message just like from a real broadcast list.
+const broadcastListsSchema = `
+CREATE TABLE IF NOT EXISTS broadcast_lists (
+	name       TEXT    PRIMARY KEY,
+	created_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS broadcast_list_members (
+	list     TEXT    NOT NULL REFERENCES broadcast_lists(name) ON DELETE CASCADE,
+	jid      TEXT    NOT NULL,
+	member   TEXT    NOT NULL,
+	added_at INTEGER NOT NULL,
+	PRIMARY KEY (list, jid)
+)`
+
+// broadcastListName is what a list may be called. The name is also the
+// default results file, so it is kept to characters safe in a file name.
+var broadcastListName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// broadcastList is a list with its members, as they were given when added.
+type broadcastList struct {
+	Name    string
+	Members []string
+}
+
+// broadcastStore keeps broadcast lists in the session database.
+type broadcastStore struct {
+	db *sql.DB
+}
+
+func openBroadcastStore(dbPath string) (*broadcastStore, error) {
+	db, err := clientOptions.DB.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open broadcast list store: %v", err)
+	}
+	if _, err := db.Exec(broadcastListsSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create broadcast list tables: %v", err)
+	}
+	return &broadcastStore{db: db}, nil
+}
+
+func (s *broadcastStore) Close() error {
+	return s.db.Close()
+}
+
+// Create adds an empty list, reporting false if one of that name exists.
+func (s *broadcastStore) Create(name string) (bool, error) {
+	res, err := s.db.Exec(`INSERT INTO broadcast_lists (name, created_at) VALUES (?, ?) ON CONFLICT DO NOTHING`, name, time.Now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("failed to create broadcast list: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Delete removes a list and its members, reporting false if it didn't exist.
+func (s *broadcastStore) Delete(name string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM broadcast_lists WHERE name = ?`, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete broadcast list: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Add adds a member as given, e.g. a phone number, keyed by its JID so the
+// same person isn't added twice in different spellings. It reports false if
+// they were already on the list.
+func (s *broadcastStore) Add(name, member string) (bool, error) {
+	jid, err := whatsappclient.ParseRecipient(member)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.Exec(`INSERT INTO broadcast_list_members (list, jid, member, added_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		name, jid.ToNonAD().String(), member, time.Now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("failed to add broadcast list member: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Remove removes a member in any spelling of their number, reporting false
+// if they weren't on the list.
+func (s *broadcastStore) Remove(name, member string) (bool, error) {
+	jid, err := whatsappclient.ParseRecipient(member)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.Exec(`DELETE FROM broadcast_list_members WHERE list = ? AND jid = ?`, name, jid.ToNonAD().String())
+	if err != nil {
+		return false, fmt.Errorf("failed to remove broadcast list member: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Get loads a list with its members in the order they were added.
+func (s *broadcastStore) Get(name string) (*broadcastList, error) {
+	var exists int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM broadcast_lists WHERE name = ?`, name).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to query broadcast list: %v", err)
+	} else if exists == 0 {
+		return nil, fmt.Errorf("no broadcast list %q; create it with broadcast-list create %s", name, name)
+	}
+
+	rows, err := s.db.Query(`SELECT member FROM broadcast_list_members WHERE list = ? ORDER BY added_at, rowid`, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query broadcast list members: %v", err)
+	}
+	defer rows.Close()
+
+	list := &broadcastList{Name: name}
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return nil, fmt.Errorf("failed to read broadcast list members: %v", err)
+		}
+		list.Members = append(list.Members, member)
+	}
+	return list, rows.Err()
+}
+
+// Lists returns every list's name and member count, by name.
+func (s *broadcastStore) Lists() ([]string, map[string]int, error) {
+	rows, err := s.db.Query(`SELECT l.name, COUNT(m.jid) FROM broadcast_lists l
+		LEFT JOIN broadcast_list_members m ON m.list = l.name GROUP BY l.name ORDER BY l.name`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query broadcast lists: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	counts := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var n int
+		if err := rows.Scan(&name, &n); err != nil {
+			return nil, nil, fmt.Errorf("failed to read broadcast lists: %v", err)
+		}
+		names = append(names, name)
+		counts[name] = n
+	}
+	return names, counts, rows.Err()
+}
+
+func broadcastListUsage() error {
+	fmt.Println("Usage: broadcast-list [show [name]]")
+	fmt.Println("       broadcast-list create <name> | broadcast-list delete <name>")
+	fmt.Println("       broadcast-list add <name> <member>... | broadcast-list remove <name> <member>...")
+	return errUsage
+}
+
+// manageBroadcastLists implements the broadcast-list subcommands.
+func manageBroadcastLists(args []string) error {
+	args = parseCommandFlags(newFlagSet("broadcast-list"), args)
+
+	action := "show"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	switch action {
+	case "show":
+		if len(args) > 1 {
+			return broadcastListUsage()
+		}
+	case "create", "delete":
+		if len(args) != 1 {
+			return broadcastListUsage()
+		}
+	case "add", "remove":
+		if len(args) < 2 {
+			return broadcastListUsage()
+		}
+		for _, member := range args[1:] {
+			// Members are keyed by JID without loading the session, which
+			// "me" would need
+			if whatsappclient.IsSelf(member) {
+				return fmt.Errorf("%q can't be a broadcast list member; use your own phone number instead", member)
+			}
+			if err := whatsappclient.ValidateRecipient(member); err != nil {
+				return err
+			}
+		}
+	default:
+		return broadcastListUsage()
+	}
+	if len(args) > 0 && !broadcastListName.MatchString(args[0]) {
+		return fmt.Errorf("invalid broadcast list name %q: use letters, digits, '.', '-' and '_'", args[0])
+	}
+
+	dbPath, err := whatsappclient.ResolveDBPath(clientOptions.DBPath)
+	if err != nil {
+		return err
+	}
+	store, err := openBroadcastStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch action {
+	case "create":
+		created, err := store.Create(args[0])
+		if err != nil {
+			return err
+		} else if !created {
+			return fmt.Errorf("broadcast list %q already exists", args[0])
+		}
+		fmt.Printf("Created broadcast list %s; add members with broadcast-list add %s <member>...\n", args[0], args[0])
+	case "delete":
+		deleted, err := store.Delete(args[0])
+		if err != nil {
+			return err
+		} else if !deleted {
+			return fmt.Errorf("no broadcast list %q", args[0])
+		}
+		fmt.Printf("Deleted broadcast list %s\n", args[0])
+	case "add", "remove":
+		// Get fails for a list that doesn't exist, which the members'
+		// foreign key would only report as a constraint failure
+		if _, err := store.Get(args[0]); err != nil {
+			return err
+		}
+		for _, member := range args[1:] {
+			var changed bool
+			if action == "add" {
+				changed, err = store.Add(args[0], member)
+			} else {
+				changed, err = store.Remove(args[0], member)
+			}
+			if err != nil {
+				return err
+			}
+			switch {
+			case action == "add" && changed:
+				fmt.Printf("Added %s to %s\n", member, args[0])
+			case action == "add":
+				fmt.Printf("%s is already on %s\n", member, args[0])
+			case changed:
+				fmt.Printf("Removed %s from %s\n", member, args[0])
+			default:
+				fmt.Printf("%s is not on %s\n", member, args[0])
+			}
+		}
+	case "show":
+		if len(args) == 1 {
+			list, err := store.Get(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s (%d %s)\n", list.Name, len(list.Members), plural(len(list.Members), "member", "members"))
+			for _, member := range list.Members {
+				fmt.Printf("  %s\n", member)
+			}
+			return nil
+		}
+		names, counts, err := store.Lists()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Println("No broadcast lists; create one with broadcast-list create <name>")
+			return nil
+		}
+		for _, name := range names {
+			fmt.Printf("%-24s %d %s\n", name, counts[name], plural(counts[name], "member", "members"))
+		}
+	}
+	return nil
+}
+
+// sendBroadcast sends a text to every member of a broadcast list, one
+// private message each, at the bulk sending rate. The results file has the
+// bulk-send format, so retry-failed can resend the failures.
+func sendBroadcast(ctx context.Context, args []string) error {
+	fs := newFlagSet("broadcast")
+	var opts bulkOptions
+	opts.register(fs)
+	resultsPath := fs.String("results", "", "CSV file to record per-member results (default: <list-name>.results.csv)")
+	args = parseCommandFlags(fs, args)
+
+	if len(args) != 2 {
+		fmt.Println("Usage: broadcast <list-name> <text|-> [--rate <n>] [--retries <n>] [--dry-run]")
+		return errUsage
+	}
+	text := args[1]
+	if text == "-" {
+		var err error
+		if text, err = readMessageText("-", false); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("message text is empty")
+	}
+
+	dbPath, err := whatsappclient.ResolveDBPath(clientOptions.DBPath)
+	if err != nil {
+		return err
+	}
+	store, err := openBroadcastStore(dbPath)
+	if err != nil {
+		return err
+	}
+	list, err := store.Get(args[0])
+	store.Close()
+	if err != nil {
+		return err
+	}
+	if len(list.Members) == 0 {
+		return fmt.Errorf("broadcast list %s has no members; add them with broadcast-list add %s <member>...", list.Name, list.Name)
+	}
+	if *resultsPath == "" {
+		*resultsPath = list.Name + ".results.csv"
+	}
+
+	if opts.dryRun {
+		for i, member := range list.Members {
+			fmt.Printf("[%d/%d] %s: %s\n", i+1, len(list.Members), member, text)
+		}
+		return nil
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	var results []bulkResult
+	for i, member := range list.Members {
+		if i > 0 && sleepContext(ctx, opts.interval()) != nil {
+			// Record who wasn't reached, so retry-failed can send to them
+			fmt.Println("Interrupted, recording the remaining members as skipped")
+			for _, rest := range list.Members[i:] {
+				results = append(results, bulkResult{Recipient: rest, Text: text, Status: bulkStatusSkipped, Error: errBulkInterrupted, Time: time.Now()})
+			}
+			break
+		}
+
+		result := bulkResult{Recipient: member, Text: text}
+		msg := &waE2E.Message{Conversation: proto.String(text)}
+		resp, err := sendWithRetry(ctx, client, member, msg, &opts)
+		result.Time = time.Now()
+		if err != nil {
+			result.Status, result.Error = bulkStatusFailed, err.Error()
+			fmt.Printf("[%d/%d] %s: failed: %v\n", i+1, len(list.Members), member, err)
+		} else {
+			result.Status, result.MessageID = bulkStatusSent, resp.ID
+			fmt.Printf("[%d/%d] %s: sent (ID: %s)\n", i+1, len(list.Members), member, resp.ID)
+		}
+		results = append(results, result)
+	}
+
+	if err := writeBulkResults(*resultsPath, results); err != nil {
+		return fmt.Errorf("failed to write results: %v", err)
+	}
+	return printBulkSummary(results, *resultsPath)
+}
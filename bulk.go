@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// bulkOptions are the throttle and retry settings shared by the bulk
+// sending commands.
+type bulkOptions struct {
+	rate    int
+	retries int
+	dryRun  bool
+
+	// backoff is shared by every send of the command
+	backoff rateLimitBackoff
+}
+
+func (o *bulkOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.rate, "rate", 20, "maximum messages sent per minute")
+	fs.IntVar(&o.retries, "retries", 2, "extra attempts for each failed send")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "print what would be sent without sending")
+}
+
+// interval is the pause between consecutive sends.
+func (o *bulkOptions) interval() time.Duration {
+	if o.rate <= 0 {
+		return 0
+	}
+	return time.Minute / time.Duration(o.rate)
+}
+
+// sendWithRetry sends msg, retrying failures with a growing delay. When
+// WhatsApp rate-limits a send, the retry and every later send of the
+// command wait out the backoff cooldown instead.
+func sendWithRetry(ctx context.Context, m messenger, recipient string, msg *waE2E.Message, opts *bulkOptions) (whatsmeow.SendResponse, error) {
+	var resp whatsmeow.SendResponse
+	var err error
+	for attempt := 0; ; attempt++ {
+		if waitErr := opts.backoff.wait(ctx); waitErr != nil {
+			return resp, waitErr
+		}
+
+		// Resolving can be rate-limited too, since it looks the number up
+		var to types.JID
+		to, err = m.ResolveRecipient(recipient)
+		if err == nil {
+			resp, err = m.SendMessage(ctx, to, msg)
+		}
+		if err == nil {
+			opts.backoff.reset()
+			return resp, nil
+		}
+
+		limited := isRateLimited(err)
+		if limited {
+			opts.backoff.hit()
+		} else if to.IsEmpty() {
+			// Bad recipients won't get better by retrying
+			return resp, err
+		}
+		if attempt >= opts.retries {
+			return resp, err
+		}
+		if limited {
+			fmt.Printf("  send to %s was rate limited, retrying after the cooldown\n", recipient)
+			continue
+		}
+
+		delay := time.Duration(attempt+1) * 2 * time.Second
+		fmt.Printf("  send to %s failed (%v), retrying in %s\n", recipient, err, delay)
+		if sleepContext(ctx, delay) != nil {
+			return resp, err
+		}
+	}
+}
+
+// Result statuses written to a bulk-send results file. Rows not reached
+// before an interrupt are skipped, and retry-failed sends them like the
+// failed ones.
+const (
+	bulkStatusSent    = "sent"
+	bulkStatusFailed  = "failed"
+	bulkStatusSkipped = "skipped"
+)
+
+// errBulkInterrupted is the error recorded for skipped rows.
+const errBulkInterrupted = "interrupted before sending"
+
+// bulkResult is one row of a bulk-send results file.
+type bulkResult struct {
+	Recipient string
+	Text      string
+	Status    string
+	MessageID string
+	Error     string
+	Time      time.Time
+}
+
+var bulkResultsHeader = []string{"recipient", "text", "status", "message_id", "error", "time"}
+
+func (r bulkResult) record() []string {
+	return []string{r.Recipient, r.Text, r.Status, r.MessageID, r.Error, r.Time.Format(time.RFC3339)}
+}
+
+// readBulkResults reads a results file written by writeBulkResults.
+func readBulkResults(path string) ([]bulkResult, error) {
+	rows, err := readCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]bulkResult, 0, len(rows))
+	for _, row := range rows {
+		r := bulkResult{
+			Recipient: row["recipient"],
+			Text:      row["text"],
+			Status:    row["status"],
+			MessageID: row["message_id"],
+			Error:     row["error"],
+		}
+		if r.Status != bulkStatusSent && r.Status != bulkStatusFailed && r.Status != bulkStatusSkipped {
+			return nil, fmt.Errorf("%s is not a bulk-send results file (row with status %q)", path, r.Status)
+		}
+		r.Time, _ = time.Parse(time.RFC3339, row["time"])
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// readCSV reads a CSV file with a header row into one map per row, keyed by
+// column name.
+func readCSV(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var rows []map[string]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %v", err)
+		}
+		row := make(map[string]string, len(header))
+		for i, value := range record {
+			if i < len(header) {
+				row[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// recipientColumn returns the recipient of a bulk-send CSV row, which may be
+// in a "recipient" or "phone" column.
+func recipientColumn(row map[string]string) string {
+	if r := row["recipient"]; r != "" {
+		return r
+	}
+	return row["phone"]
+}
+
+func bulkSend(ctx context.Context, args []string) error {
+	fs := newFlagSet("bulk-send")
+	var opts bulkOptions
+	opts.register(fs)
+	strict := fs.Bool("strict-template", false, "fail a row whose template placeholders can't all be filled")
+	resultsPath := fs.String("results", "", "CSV file to record per-recipient results (default: <csv>.results.csv)")
+	args = parseCommandFlags(fs, args)
+
+	if len(args) != 2 {
+		fmt.Println("Usage: bulk-send <csv-file> <template> [--rate <n>] [--retries <n>] [--strict-template] [--dry-run]")
+		return errUsage
+	}
+
+	tmpl, err := compileMessageTemplate(args[1], *strict)
+	if err != nil {
+		return err
+	}
+
+	rows, err := readCSV(args[0])
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if err := whatsappclient.ValidateRecipient(recipientColumn(row)); err != nil {
+			return fmt.Errorf("row %d: %v", i+2, err)
+		}
+	}
+
+	if *resultsPath == "" {
+		*resultsPath = args[0] + ".results.csv"
+	}
+
+	// A dry run still loads the store so {name} can fall back to contact names
+	var client *whatsappclient.Client
+	if opts.dryRun {
+		client, err = setupClient()
+	} else {
+		client, err = connectClient()
+	}
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	// After an interrupt the remaining rows are still rendered and recorded
+	// as skipped, so retry-failed can send them
+	interrupted := false
+	var results []bulkResult
+	for i, row := range rows {
+		recipient := recipientColumn(row)
+		result := bulkResult{Recipient: recipient, Time: time.Now()}
+
+		if row["name"] == "" {
+			// Once interrupted, don't look numbers up with WhatsApp
+			resolve := client.ResolveRecipient
+			if interrupted {
+				resolve = whatsappclient.ParseRecipient
+			}
+			if jid, err := resolve(recipient); err == nil {
+				row["name"] = contactName(client, jid)
+			}
+		}
+
+		result.Text, err = renderMessageTemplate(tmpl, row)
+		if err != nil {
+			result.Status, result.Error = bulkStatusFailed, err.Error()
+			fmt.Printf("[%d/%d] %s: %v\n", i+1, len(rows), recipient, err)
+			results = append(results, result)
+			continue
+		}
+
+		if opts.dryRun {
+			fmt.Printf("[%d/%d] %s: %s\n", i+1, len(rows), recipient, result.Text)
+			continue
+		}
+
+		if !interrupted && i > 0 && sleepContext(ctx, opts.interval()) != nil {
+			fmt.Println("Interrupted, recording the remaining rows as skipped")
+			interrupted = true
+		}
+		if interrupted {
+			result.Status, result.Error = bulkStatusSkipped, errBulkInterrupted
+			results = append(results, result)
+			continue
+		}
+
+		msg := &waE2E.Message{Conversation: proto.String(result.Text)}
+		resp, err := sendWithRetry(ctx, client, recipient, msg, &opts)
+		result.Time = time.Now()
+		if err != nil {
+			result.Status, result.Error = bulkStatusFailed, err.Error()
+			fmt.Printf("[%d/%d] %s: failed: %v\n", i+1, len(rows), recipient, err)
+		} else {
+			result.Status, result.MessageID = bulkStatusSent, resp.ID
+			fmt.Printf("[%d/%d] %s: sent (ID: %s)\n", i+1, len(rows), recipient, resp.ID)
+		}
+		results = append(results, result)
+	}
+
+	if opts.dryRun {
+		return nil
+	}
+
+	if err := writeBulkResults(*resultsPath, results); err != nil {
+		return fmt.Errorf("failed to write results: %v", err)
+	}
+	return printBulkSummary(results, *resultsPath)
+}
+
+func retryFailed(ctx context.Context, args []string) error {
+	fs := newFlagSet("retry-failed")
+	var opts bulkOptions
+	opts.register(fs)
+	args = parseCommandFlags(fs, args)
+
+	if len(args) != 1 {
+		fmt.Println("Usage: retry-failed <results-file> [--rate <n>] [--retries <n>] [--dry-run]")
+		return errUsage
+	}
+
+	results, err := readBulkResults(args[0])
+	if err != nil {
+		return err
+	}
+
+	var failed []int
+	for i, r := range results {
+		// Rows that failed to render have no text to resend
+		if (r.Status == bulkStatusFailed || r.Status == bulkStatusSkipped) && r.Text != "" {
+			failed = append(failed, i)
+		}
+	}
+	if len(failed) == 0 {
+		fmt.Println("No failed sends to retry")
+		return nil
+	}
+
+	if opts.dryRun {
+		for n, i := range failed {
+			fmt.Printf("[%d/%d] %s: %s\n", n+1, len(failed), results[i].Recipient, results[i].Text)
+		}
+		return nil
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	for n, i := range failed {
+		if n > 0 && sleepContext(ctx, opts.interval()) != nil {
+			fmt.Println("Interrupted, stopping")
+			break
+		}
+
+		r := &results[i]
+		msg := &waE2E.Message{Conversation: proto.String(r.Text)}
+		resp, err := sendWithRetry(ctx, client, r.Recipient, msg, &opts)
+		r.Time = time.Now()
+		if err != nil {
+			r.Status, r.Error = bulkStatusFailed, err.Error()
+			fmt.Printf("[%d/%d] %s: failed: %v\n", n+1, len(failed), r.Recipient, err)
+		} else {
+			r.Status, r.MessageID, r.Error = bulkStatusSent, resp.ID, ""
+			fmt.Printf("[%d/%d] %s: sent (ID: %s)\n", n+1, len(failed), r.Recipient, resp.ID)
+		}
+	}
+
+	if err := writeBulkResults(args[0], results); err != nil {
+		return fmt.Errorf("failed to write results: %v", err)
+	}
+	return printBulkSummary(results, args[0])
+}
+
+// writeBulkResults replaces path with the results, writing to a temp file
+// first so an interrupted write doesn't lose the previous results.
+func writeBulkResults(path string, results []bulkResult) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	w.Write(bulkResultsHeader)
+	for _, r := range results {
+		w.Write(r.record())
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// printBulkSummary prints the totals and returns a send failure error if any
+// row failed or was skipped.
+func printBulkSummary(results []bulkResult, path string) error {
+	failed, skipped := 0, 0
+	for _, r := range results {
+		switch r.Status {
+		case bulkStatusFailed:
+			failed++
+		case bulkStatusSkipped:
+			skipped++
+		}
+	}
+	fmt.Printf("\n%d sent, %d failed", len(results)-failed-skipped, failed)
+	if skipped > 0 {
+		fmt.Printf(", %d skipped", skipped)
+	}
+	fmt.Printf(". Results written to %s\n", path)
+	if skipped > 0 {
+		return withExitCode(exitSendFailure, fmt.Errorf("%d of %d rows failed or were skipped", failed+skipped, len(results)))
+	} else if failed > 0 {
+		return withExitCode(exitSendFailure, fmt.Errorf("%d of %d rows failed", failed, len(results)))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// maxButtons is the most reply buttons WhatsApp shows on a buttons message.
+const maxButtons = 3
+
+// buildButtonsMessage builds a legacy ButtonsMessage with a text body and
+// up to three reply buttons, whose IDs are their 1-based positions.
+func buildButtonsMessage(body, footer string, labels []string) (*waE2E.Message, error) {
+	if len(labels) == 0 || len(labels) > maxButtons {
+		return nil, fmt.Errorf("a buttons message needs 1 to %d buttons, got %d", maxButtons, len(labels))
+	}
+
+	buttons := make([]*waE2E.ButtonsMessage_Button, len(labels))
+	for i, label := range labels {
+		buttons[i] = &waE2E.ButtonsMessage_Button{
+			ButtonID:   proto.String(strconv.Itoa(i + 1)),
+			ButtonText: &waE2E.ButtonsMessage_Button_ButtonText{DisplayText: proto.String(label)},
+			Type:       waE2E.ButtonsMessage_Button_RESPONSE.Enum(),
+		}
+	}
+
+	msg := &waE2E.ButtonsMessage{
+		ContentText: proto.String(body),
+		HeaderType:  waE2E.ButtonsMessage_EMPTY.Enum(),
+		Buttons:     buttons,
+	}
+	if footer != "" {
+		msg.FooterText = proto.String(footer)
+	}
+	return &waE2E.Message{ButtonsMessage: msg}, nil
+}
+
+func sendButtons(ctx context.Context, args []string) error {
+	fs := newFlagSet("send-buttons")
+	footer := fs.String("footer", "", "small text shown under the message body")
+	args = parseCommandFlags(fs, args)
+
+	if len(args) < 3 {
+		fmt.Println("Usage: send-buttons <recipient> <body> <button> [button] [button] [--footer <text>]")
+		return errUsage
+	}
+
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return err
+	}
+
+	msg, err := buildButtonsMessage(args[1], *footer, args[2:])
+	if err != nil {
+		return err
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	return sendAndReport(ctx, client, args[0], msg, "buttons message")
+}
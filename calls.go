@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// isVideoCall reports whether call offer data describes a video call.
+func isVideoCall(data *waBinary.Node) bool {
+	if data == nil {
+		return false
+	}
+	_, ok := data.GetOptionalChildByTag("video")
+	return ok
+}
+
+func printCall(kind string, meta types.BasicCallMeta, detail string) {
+	fmt.Printf("[Call] %s from %s (call ID: %s) at %s%s\n",
+		kind, formatJID(meta.From), meta.CallID, meta.Timestamp.Local().Format("2006-01-02 15:04:05"), detail)
+}
+
+// printCallEvent prints incoming call offers and their lifecycle.
+func printCallEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.CallOffer:
+		kind := "Voice call"
+		if isVideoCall(v.Data) {
+			kind = "Video call"
+		}
+		printCall(kind+" offer", v.BasicCallMeta, "")
+	case *events.CallOfferNotice:
+		printCall(fmt.Sprintf("%s %s call offer", v.Type, v.Media), v.BasicCallMeta, "")
+	case *events.CallAccept:
+		printCall("Call accepted", v.BasicCallMeta, "")
+	case *events.CallReject:
+		printCall("Call rejected", v.BasicCallMeta, "")
+	case *events.CallTerminate:
+		printCall("Call ended", v.BasicCallMeta, fmt.Sprintf(" (reason: %s)", v.Reason))
+	}
+}
+
+// rejectCall declines an incoming call offer so the account doesn't ring.
+func rejectCall(client *whatsappclient.Client, offer *events.CallOffer) {
+	if err := client.RejectCall(offer.From, offer.CallID); err != nil {
+		fmt.Printf("Failed to reject call %s from %s: %v\n", offer.CallID, formatJID(offer.From), err)
+		return
+	}
+	fmt.Printf("[Call] Rejected call %s from %s\n", offer.CallID, formatJID(offer.From))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// appStateSyncTimeout bounds how long chat commands wait for the initial
+// app-state sync of a collection before fetching it themselves.
+const appStateSyncTimeout = 30 * time.Second
+
+// waitForAppStateSync makes sure the app-state collection name has been
+// synced at least once, since patches are built on top of its current
+// version. A freshly connected client syncs on its own and emits
+// AppStateSyncComplete; if that doesn't happen in time, fetch it directly.
+func waitForAppStateSync(client *whatsappclient.Client, name appstate.WAPatchName) error {
+	version, _, err := client.Store.AppState.GetAppStateVersion(string(name))
+	if err != nil {
+		return fmt.Errorf("failed to get app state version: %v", err)
+	}
+	if version > 0 {
+		return nil
+	}
+
+	synced := make(chan struct{}, 1)
+	handlerID := client.AddEventHandler(func(evt interface{}) {
+		if v, ok := evt.(*events.AppStateSyncComplete); ok && v.Name == name {
+			select {
+			case synced <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer client.RemoveEventHandler(handlerID)
+
+	fmt.Printf("Waiting for %s app state to sync...\n", name)
+	select {
+	case <-synced:
+		return nil
+	case <-time.After(appStateSyncTimeout):
+		if err := client.FetchAppState(name, false, true); err != nil {
+			return fmt.Errorf("failed to sync %s app state: %v", name, err)
+		}
+		return nil
+	}
+}
+
+// sendChatPatch connects, resolves the chat argument and sends the patch
+// built for it, reporting the result as description.
+func sendChatPatch(chatArg string, build func(chat types.JID) appstate.PatchInfo, description string) error {
+	if err := whatsappclient.ValidateRecipient(chatArg); err != nil {
+		return err
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	chat, err := client.ResolveRecipient(chatArg)
+	if err != nil {
+		return err
+	}
+
+	patch := build(chat)
+	if err := waitForAppStateSync(client, patch.Type); err != nil {
+		return err
+	}
+
+	if err := client.SendAppState(patch); err != nil {
+		return withExitCode(exitSendFailure, fmt.Errorf("failed to update chat %s: %v", chat.String(), err))
+	}
+
+	fmt.Printf("Chat %s %s\n", chat.String(), description)
+	return nil
+}
+
+func archiveChat(archive bool, args []string) error {
+	command, description := "archive", "archived"
+	if !archive {
+		command, description = "unarchive", "unarchived"
+	}
+	args = parseCommandFlags(newFlagSet(command), args)
+	if len(args) != 1 {
+		fmt.Printf("Usage: %s <chat>\n", command)
+		return errUsage
+	}
+
+	return sendChatPatch(args[0], func(chat types.JID) appstate.PatchInfo {
+		return appstate.BuildArchive(chat, archive, time.Time{}, nil)
+	}, description)
+}
+
+func pinChat(pin bool, args []string) error {
+	command, description := "pin", "pinned"
+	if !pin {
+		command, description = "unpin", "unpinned"
+	}
+	args = parseCommandFlags(newFlagSet(command), args)
+	if len(args) != 1 {
+		fmt.Printf("Usage: %s <chat>\n", command)
+		return errUsage
+	}
+
+	return sendChatPatch(args[0], func(chat types.JID) appstate.PatchInfo {
+		return appstate.BuildPin(chat, pin)
+	}, description)
+}
+
+// parseMuteDuration accepts a Go duration (8h, 30m) or "forever".
+func parseMuteDuration(arg string) (time.Duration, error) {
+	if arg == "forever" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mute duration %q: use a duration like 8h or \"forever\"", arg)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("mute duration must be positive")
+	}
+	return d, nil
+}
+
+func muteChat(args []string) error {
+	args = parseCommandFlags(newFlagSet("mute"), args)
+
+	if len(args) != 2 {
+		fmt.Println("Usage: mute <chat> <duration|forever>")
+		return errUsage
+	}
+
+	duration, err := parseMuteDuration(args[1])
+	if err != nil {
+		return err
+	}
+
+	description := "muted forever"
+	if duration > 0 {
+		description = fmt.Sprintf("muted for %s", duration)
+	}
+	return sendChatPatch(args[0], func(chat types.JID) appstate.PatchInfo {
+		return appstate.BuildMute(chat, true, duration)
+	}, description)
+}
+
+func unmuteChat(args []string) error {
+	args = parseCommandFlags(newFlagSet("unmute"), args)
+
+	if len(args) != 1 {
+		fmt.Println("Usage: unmute <chat>")
+		return errUsage
+	}
+
+	return sendChatPatch(args[0], func(chat types.JID) appstate.PatchInfo {
+		return appstate.BuildMute(chat, false, 0)
+	}, "unmuted")
+}
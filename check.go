@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+func checkNumbers(args []string) error {
+	args = parseCommandFlags(newFlagSet("check"), args)
+
+	if len(args) == 0 {
+		fmt.Println("Usage: check <phone> [phone...] [--no-cache]")
+		return errUsage
+	}
+
+	var numbers []string
+	for _, arg := range splitRecipients(args) {
+		if strings.Contains(arg, "@") {
+			return fmt.Errorf("%s is a JID, not a phone number", arg)
+		}
+		jid, err := whatsappclient.ParseRecipient(arg)
+		if err != nil {
+			return err
+		}
+		numbers = append(numbers, jid.User)
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	for _, number := range numbers {
+		lookup, err := client.LookupPhone(number)
+		if err != nil {
+			fmt.Printf("%-16s error: %v\n", number, err)
+			continue
+		}
+
+		source := "checked"
+		if lookup.Cached {
+			source = "cached " + lookup.CheckedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		if lookup.Registered {
+			fmt.Printf("%-16s on WhatsApp as %s (%s)\n", number, lookup.JID.String(), source)
+		} else {
+			fmt.Printf("%-16s not on WhatsApp (%s)\n", number, source)
+		}
+	}
+	return nil
+}
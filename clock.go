@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// clockSkewThreshold is how far off the local clock may be before a warning
+// is logged. WhatsApp rejects or misorders receipts and messages whose
+// timestamps are too far from its own.
+const clockSkewThreshold = 30 * time.Second
+
+// checkClockSkew compares the local clock with WhatsApp's and warns if it is
+// off by more than clockSkewThreshold. setupClient runs it in the
+// background so commands don't wait on it; failures are only logged at
+// debug level, since being offline is reported by the connection itself.
+func checkClockSkew(client *whatsappclient.Client, log waLog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	skew, err := client.ClockSkew(ctx)
+	if err != nil {
+		log.Debugf("Couldn't check the clock: %v", err)
+		return
+	}
+	if skew.Abs() <= clockSkewThreshold {
+		log.Debugf("Local clock is within %s of WhatsApp's", skew.Abs().Round(time.Second))
+		return
+	}
+
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	log.Warnf("Local clock is %s %s WhatsApp's. Message timestamps and receipts may be wrong; sync the system clock (e.g. with NTP)", skew.Abs().Round(time.Second), direction)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// command is a subcommand of the CLI. Each one parses its own flags with
+// newFlagSet, so run gets the arguments after the command name.
+type command struct {
+	name string
+	// args, summary and example make up the command's --help, along with
+	// the flags it registers
+	args    string
+	summary string
+	example string
+	// aliases are other names the command can be run by
+	aliases []string
+	run     func(ctx context.Context, args []string) error
+}
+
+// commands are the CLI's subcommands, in the order printHelp lists them.
+var commands = []command{
+	{name: "message", args: "[options]", summary: "Listen for incoming WhatsApp messages", example: "message --store-messages --download-dir ./media", aliases: []string{"msg", "listen"}, run: func(ctx context.Context, args []string) error {
+		return listenForMessages(ctx, "message", args)
+	}},
+	{name: "watch", args: "[options]", summary: "Listen like message, printing one line per message", example: "watch --chat 120363025246125486@g.us --from 15551234567", run: func(ctx context.Context, args []string) error {
+		return listenForMessages(ctx, "watch", args)
+	}},
+	{name: "qr", args: "[options]", summary: "Generate a QR code to log in, and wait for the initial sync", example: `qr --device-name "Office PC" --exit-on-login`, aliases: []string{"login"}, run: generateQR},
+	{name: "pull", args: "[options]", summary: "Connect, print the messages received while offline, and exit", example: "pull --json --store-messages", run: pullMessages},
+	{name: "send", args: "<recipient>[,<recipient>...] <text|->", summary: "Send a text message to one or more recipients", example: `send 15551234567 "hello"`, run: sendText},
+	{name: "bulk-send", args: "<csv-file> <template>", summary: "Send a templated message to every row of a CSV file", example: `bulk-send customers.csv "Hi {name}, your order {order} has shipped" --dry-run`, run: bulkSend},
+	{name: "retry-failed", args: "<results-file>", summary: "Resend the failed rows of a bulk-send results file, updating it in place", example: "retry-failed customers.csv.results.csv", run: retryFailed},
+	{name: "broadcast", args: "<list-name> <text|->", summary: "Send a text privately to every member of a broadcast list", example: `broadcast customers "We're closed on Monday" --rate 10`, run: sendBroadcast},
+	{name: "broadcast-list", args: "[show [name] | create|delete <name> | add|remove <name> <member>...]", summary: "Manage the broadcast lists kept in the session database", example: "broadcast-list add customers 15551234567 15557654321", run: withoutContext(manageBroadcastLists)},
+	{name: "send-buttons", args: "<recipient> <body> <button> [button] [button]", summary: "Send a message with up to three reply buttons", example: `send-buttons 15551234567 "Confirm your order?" Yes No --footer "Reply within 24h"`, run: sendButtons},
+	{name: "send-contact", args: "<recipient> <name> <phone> [<name> <phone>...]", summary: "Share one or more contact cards (vCards)", example: `send-contact 15551234567 "Jane Doe" 15557654321`, run: sendContact},
+	{name: "send-poll", args: "<recipient> <question> <option> <option> [option...]", summary: "Send a poll with 2 to 12 options", example: `send-poll 120363025246125486@g.us "Lunch?" Pizza Sushi Tacos --multi`, run: sendPoll},
+	{name: "send-location", args: "<recipient> <lat> <lng> [name] [address]", summary: "Send a location pin", example: `send-location 15551234567 48.8584 2.2945 "Eiffel Tower"`, run: sendLocation},
+	{name: "send-live-location", args: "<recipient> <duration>", summary: `Share a live location, updated from "lat,lng" lines on stdin or a GPX track`, example: "send-live-location 15551234567 15m --gpx route.gpx", run: sendLiveLocation},
+	{name: "schedule", args: "<recipient> <time> <text|->", summary: "Queue a text message for a listener running with --send-scheduled", example: `schedule 15551234567 "2025-01-02 09:00" "Good morning" --tz Europe/Paris`, run: withoutContext(scheduleMessage)},
+	{name: "forward", args: "<source-chat> <message-id> <recipient>", summary: "Forward a message recorded with --store-messages to another chat", example: "forward 15551234567 3EB0ABCDEF 15557654321", run: forwardMessage},
+	{name: "send-image", args: "<recipient> <path>", summary: "Upload and send an image", example: `send-image 15551234567 photo.jpg --caption "Look"`, run: func(ctx context.Context, args []string) error {
+		return sendMedia(ctx, mediaImage, args)
+	}},
+	{name: "send-video", args: "<recipient> <path>", summary: "Upload and send a video", example: `send-video 15551234567 clip.mp4 --caption "Highlights"`, run: func(ctx context.Context, args []string) error {
+		return sendMedia(ctx, mediaVideo, args)
+	}},
+	{name: "send-document", args: "<recipient> <path>", summary: "Upload and send a file as a document", example: "send-document 15551234567 report.pdf --thumbnail cover.png", run: func(ctx context.Context, args []string) error {
+		return sendMedia(ctx, mediaDocument, args)
+	}},
+	{name: "send-album", args: "<recipient> <path> <path> [path...]", summary: "Send 2 to 30 images and videos grouped as one album", example: `send-album 15551234567 beach1.jpg beach2.jpg clip.mp4 --caption "Weekend"`, run: sendAlbum},
+	{name: "send-voice", args: "<recipient> <path>", summary: "Send an Ogg Opus file as a voice note", example: "send-voice 15551234567 memo.ogg", run: func(ctx context.Context, args []string) error {
+		return sendMedia(ctx, mediaVoice, args)
+	}},
+	{name: "block", args: "<jid>", summary: "Block a contact", example: "block 15551234567", run: func(_ context.Context, args []string) error {
+		return updateBlocklist(events.BlocklistChangeActionBlock, args)
+	}},
+	{name: "unblock", args: "<jid>", summary: "Unblock a contact", example: "unblock 15551234567", run: func(_ context.Context, args []string) error {
+		return updateBlocklist(events.BlocklistChangeActionUnblock, args)
+	}},
+	{name: "blocklist", args: "", summary: "Show blocked contacts", example: "blocklist", run: withoutContext(showBlocklist)},
+	{name: "privacy", args: "[set <setting> <value>]", summary: "Show or change who sees your last seen, photo, about, etc.", example: "privacy set last-seen contacts", run: withoutContext(privacySettings)},
+	{name: "archive", args: "<chat>", summary: "Archive a chat (synced to your phone)", example: "archive 15551234567", run: func(_ context.Context, args []string) error {
+		return archiveChat(true, args)
+	}},
+	{name: "unarchive", args: "<chat>", summary: "Unarchive a chat", example: "unarchive 15551234567", run: func(_ context.Context, args []string) error {
+		return archiveChat(false, args)
+	}},
+	{name: "pin", args: "<chat>", summary: "Pin a chat (synced to your phone)", example: "pin 120363025246125486@g.us", run: func(_ context.Context, args []string) error {
+		return pinChat(true, args)
+	}},
+	{name: "unpin", args: "<chat>", summary: "Unpin a chat", example: "unpin 120363025246125486@g.us", run: func(_ context.Context, args []string) error {
+		return pinChat(false, args)
+	}},
+	{name: "mute", args: "<chat> <duration|forever>", summary: "Mute a chat for a while or for good", example: "mute 120363025246125486@g.us 8h", run: withoutContext(muteChat)},
+	{name: "unmute", args: "<chat>", summary: "Unmute a chat", example: "unmute 120363025246125486@g.us", run: withoutContext(unmuteChat)},
+	{name: "set-name", args: "<name>", summary: "Set the push name other users see", example: `set-name "Support Bot"`, run: withoutContext(setName)},
+	{name: "download", args: "<chat> <message-id>", summary: "Download the media of a message recorded with --store-messages", example: "download 15551234567 3EB0ABCDEF --out photo.jpg", run: withoutContext(downloadMedia)},
+	{name: "stats", args: "[chat]", summary: "Count messages recorded with --store-messages by type, sender, day and chat", example: "stats --since 2024-01-01 --json", run: withoutContext(showStats)},
+	{name: "search", args: "<query>", summary: "Find messages recorded with --store-messages containing the text, newest first", example: `search "see you tomorrow" --chat 15551234567 --limit 5`, run: withoutContext(searchMessages)},
+	{name: "export-session", args: "<file>", summary: "Save the logged-in session to a passphrase-encrypted file", example: "export-session session.bin", run: withoutContext(exportSession)},
+	{name: "import-session", args: "<file>", summary: "Load a session saved with export-session on another machine", example: "import-session session.bin", run: withoutContext(importSession)},
+	{name: "restore-backup", args: "<file>", summary: "Replace the session database with a backup taken before a risky change", example: "restore-backup backups/whatsapp-20240102-150405.db", run: withoutContext(restoreBackup)},
+	{name: "resync-appstate", args: "", summary: "Fetch contacts and chat settings again from a full app-state snapshot", example: "resync-appstate", run: withoutContext(resyncAppState)},
+	{name: "check", args: "<phone> [phone...]", summary: "Check whether phone numbers are on WhatsApp", example: "check 15551234567 15557654321", run: withoutContext(checkNumbers)},
+	{name: "contact", args: "<phone|jid|me>", summary: "Show a contact's names, about text and profile picture", example: "contact 15551234567 --json", run: withoutContext(showContact)},
+	{name: "status-text", args: "<phone|jid|me>...", summary: "Show the about text of one or more users and when it was set", example: "status-text 15551234567 15557654321", run: showStatusText},
+	{name: "contacts", args: "", summary: "List contacts from the local store", example: "contacts --search alice", run: withoutContext(listContacts)},
+	{name: "groups", args: "", summary: "List joined groups", example: "groups", run: withoutContext(listGroups)},
+	{name: "devices", args: "[remove <device-jid|device-number>]", summary: "List the devices linked to the account, or unlink one", example: "devices remove 12", run: manageDevices},
+	{name: "repl", args: "", summary: "Connect once and type commands (send, contacts, groups) at a prompt", example: "repl", run: runRepl},
+	{name: "debug-send-node", args: "--enable-dangerous <file|->", summary: "Send a raw binary node given as JSON, for protocol debugging", example: "debug-send-node --enable-dangerous node.json", run: withoutContext(debugSendNode)},
+	{name: "version", args: "", summary: "Show the app, Go, whatsmeow and WhatsApp Web versions", example: "version", aliases: []string{"--version"}, run: withoutContext(printVersion)},
+}
+
+func init() {
+	// help looks commands up, so listing it in their initializer would make
+	// commands refer to itself
+	commands = append(commands, command{name: "help", args: "[command]", summary: "Show the list of commands, or the options of one", example: "help send", aliases: []string{"-h", "--help"}, run: showHelp})
+}
+
+// running is the command main dispatched to, whose flag set prints its
+// help on --help. newFlagSet can't look it up in commands for the same
+// reason help is added in init.
+var running command
+
+// withoutContext adapts a command that has no use for the context.
+func withoutContext(run func(args []string) error) func(context.Context, []string) error {
+	return func(_ context.Context, args []string) error {
+		return run(args)
+	}
+}
+
+// findCommand looks a command up by its name or one of its aliases.
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name || slices.Contains(c.aliases, name) {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// showHelp runs help: the list of commands, or with a command name, that
+// command's help. Commands print their own, from the flags they register,
+// when run with --help.
+func showHelp(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		printHelp()
+		return nil
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		fmt.Printf("Unknown command: %s\n", args[0])
+		printHelp()
+		return errUsage
+	}
+	if cmd.name == "help" {
+		printCommandHelp(newFlagSet("help"), cmd)
+		return nil
+	}
+	running = cmd
+	return cmd.run(ctx, []string{"--help"})
+}
+
+// printCommandHelp prints a command's arguments, example and the flags it
+// registered on fs, leaving out the global ones printHelp lists.
+func printCommandHelp(fs *flag.FlagSet, cmd command) {
+	fmt.Printf("Usage: go run . %s\n", strings.TrimSpace(cmd.name+" "+cmd.args))
+	fmt.Printf("\n%s.\n", cmd.summary)
+	if len(cmd.aliases) > 0 {
+		fmt.Printf("Aliases: %s\n", strings.Join(cmd.aliases, ", "))
+	}
+
+	header := false
+	fs.VisitAll(func(f *flag.Flag) {
+		if isGlobalFlag(f.Name) {
+			return
+		}
+		if !header {
+			fmt.Println("\nOptions:")
+			header = true
+		}
+		printFlagHelp(f)
+	})
+
+	if cmd.example != "" {
+		fmt.Printf("\nExample:\n  go run . %s\n", cmd.example)
+	}
+	fmt.Println("\nGlobal options such as --db-path and --config are listed by go run . help.")
+}
+
+// printFlagHelp prints a flag like flag.PrintDefaults does, but spelled
+// with two dashes as everywhere else in the help.
+func printFlagHelp(f *flag.Flag) {
+	kind, usage := flag.UnquoteUsage(f)
+	if kind != "" {
+		kind = " <" + kind + ">"
+	}
+	fmt.Printf("  --%s%s\n      %s", f.Name, kind, usage)
+	switch f.DefValue {
+	case "", "0", "0s", "false":
+	default:
+		fmt.Printf(" (default %s)", f.DefValue)
+	}
+	fmt.Println()
+}
+
+// isGlobalFlag reports whether name is one of the flags newFlagSet
+// registers on every command.
+func isGlobalFlag(name string) bool {
+	switch name {
+	case "config", "no-cache", "quiet":
+		return true
+	}
+	return slices.ContainsFunc(globalSettings, func(s setting) bool { return s.flag == name })
+}
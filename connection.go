@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// handleConnectionFailure reports a temporary ban or rejected connection and
+// exits with the matching code. It returns false for any other event.
+func handleConnectionFailure(evt interface{}) bool {
+	switch v := evt.(type) {
+	case *events.TemporaryBan:
+		fmt.Printf("Error: %s\n", v.String())
+		if v.Expire > 0 {
+			fmt.Printf("Try again after %s\n", time.Now().Add(v.Expire).Format("2006-01-02 15:04:05"))
+		}
+		os.Exit(exitTemporaryBan)
+	case *events.ClientOutdated:
+		fmt.Println("Error: WhatsApp rejected the connection because the client is out of date")
+		printClientOutdatedHelp()
+		os.Exit(exitConnectFailure)
+	case *events.ConnectFailure:
+		fmt.Printf("Error: connection rejected by WhatsApp (%s)", v.Reason)
+		if v.Message != "" {
+			fmt.Printf(": %s", v.Message)
+		}
+		fmt.Println()
+		if v.Reason == events.ConnectFailureClientOutdated {
+			printClientOutdatedHelp()
+		}
+		os.Exit(exitConnectFailure)
+	}
+	return false
+}
+
+func printClientOutdatedHelp() {
+	fmt.Println("Update the whatsmeow dependency and rebuild:")
+	fmt.Println("  go get go.mau.fi/whatsmeow@latest && go mod tidy")
+}
+
+// streamReplacedDelay is how long the reconnect policy waits before taking
+// the session back, so two instances fighting over it don't spin.
+const streamReplacedDelay = 30 * time.Second
+
+// errStreamReplaced is returned when the exit policy ends a command because
+// the session connected elsewhere.
+var errStreamReplaced = withExitCode(exitConnectFailure, errors.New("connection replaced by another login of this session (--on-stream-replaced reconnect or wait keeps running)"))
+
+// streamReplacedPolicy is what to do when the same session connects from
+// another process or machine, which disconnects this one: exit, reconnect
+// (taking the session back, which disconnects the other side in turn) or
+// wait without reconnecting until interrupted.
+type streamReplacedPolicy struct {
+	value string
+}
+
+func (p *streamReplacedPolicy) register(fs *flag.FlagSet) {
+	fs.StringVar(&p.value, "on-stream-replaced", "exit", "when another login of this session takes over: exit, reconnect (after 30s) or wait")
+}
+
+func (p *streamReplacedPolicy) validate() error {
+	switch p.value {
+	case "exit", "reconnect", "wait":
+		return nil
+	}
+	return fmt.Errorf("invalid --on-stream-replaced %q: must be exit, reconnect or wait", p.value)
+}
+
+// handle reacts to a StreamReplaced event. It reports whether the command
+// should exit, leaving the message to the caller.
+func (p *streamReplacedPolicy) handle(ctx context.Context, client *whatsappclient.Client) bool {
+	switch p.value {
+	case "reconnect":
+		fmt.Printf("Connection replaced by another login, reconnecting in %s\n", streamReplacedDelay)
+		go func() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(streamReplacedDelay):
+			}
+			if err := client.Connect(); err != nil {
+				fmt.Printf("Error reconnecting: %v\n", err)
+			}
+		}()
+		return false
+	case "wait":
+		fmt.Println("Connection replaced by another login, waiting (Press Ctrl+C to exit)")
+		return false
+	}
+	return true
+}
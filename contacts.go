@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// displayName picks the best available name for a contact, preferring the
+// name saved in the address book.
+func displayName(contact types.ContactInfo) string {
+	for _, name := range []string{contact.FullName, contact.FirstName, contact.PushName, contact.BusinessName} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// listOptions filters and paginates the contacts and groups listings.
+type listOptions struct {
+	search string
+	limit  int
+	offset int
+}
+
+func (o *listOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.search, "search", "", "only list entries whose name or JID contains this text (case-insensitive)")
+	fs.IntVar(&o.limit, "limit", 0, "list at most this many entries (0 = no limit)")
+	fs.IntVar(&o.offset, "offset", 0, "skip this many matching entries")
+}
+
+// matches reports whether any of values contains the search text.
+func (o listOptions) matches(values ...string) bool {
+	if o.search == "" {
+		return true
+	}
+	search := strings.ToLower(o.search)
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// page returns the [start, end) range of n matching entries to print.
+func (o listOptions) page(n int) (int, int) {
+	start := min(max(o.offset, 0), n)
+	end := n
+	if o.limit > 0 {
+		end = min(start+o.limit, n)
+	}
+	return start, end
+}
+
+// printContacts lists the contacts in the local store, sorted by name.
+func printContacts(client *whatsappclient.Client, opts listOptions) error {
+	contacts, err := client.Store.Contacts.GetAllContacts()
+	if err != nil {
+		return fmt.Errorf("failed to load contacts: %v", err)
+	}
+
+	jids := make([]types.JID, 0, len(contacts))
+	for jid, contact := range contacts {
+		if opts.matches(contact.FullName, contact.PushName, jid.String()) {
+			jids = append(jids, jid)
+		}
+	}
+	sort.Slice(jids, func(i, j int) bool {
+		return displayName(contacts[jids[i]]) < displayName(contacts[jids[j]])
+	})
+
+	start, end := opts.page(len(jids))
+	for _, jid := range jids[start:end] {
+		fmt.Printf("%-40s %s\n", jid.String(), displayName(contacts[jid]))
+	}
+	printListFooter("contacts", start, end, len(jids))
+	return nil
+}
+
+// printGroups lists the groups the account is a member of. The client must
+// be connected.
+func printGroups(client *whatsappclient.Client, opts listOptions) error {
+	joined, err := client.GetJoinedGroups()
+	if err != nil {
+		return fmt.Errorf("failed to get groups: %v", err)
+	}
+
+	var groups []*types.GroupInfo
+	for _, group := range joined {
+		if opts.matches(group.Name, group.JID.String()) {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	start, end := opts.page(len(groups))
+	for _, group := range groups[start:end] {
+		fmt.Printf("%-40s %s (%d members)\n", group.JID.String(), group.Name, len(group.Participants))
+	}
+	printListFooter("groups", start, end, len(groups))
+	return nil
+}
+
+func printListFooter(what string, start, end, total int) {
+	if start == 0 && end == total {
+		fmt.Printf("%d %s\n", total, what)
+		return
+	}
+	fmt.Printf("Showing %d-%d of %d %s\n", min(start+1, end), end, total, what)
+}
+
+func listContacts(args []string) error {
+	fs := newFlagSet("contacts")
+	var opts listOptions
+	opts.register(fs)
+	parseCommandFlags(fs, args)
+
+	// Contacts come from the local store, so there's no need to connect
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to set up client: %v", err)
+	}
+	if !isLoggedIn(client) {
+		return errNotLoggedIn(client)
+	}
+
+	return printContacts(client, opts)
+}
+
+func listGroups(args []string) error {
+	fs := newFlagSet("groups")
+	var opts listOptions
+	opts.register(fs)
+	parseCommandFlags(fs, args)
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	return printGroups(client, opts)
+}
+
+// contactDetails is everything the contact command could find out about one
+// user. Fields the user's privacy settings hide from us are left empty.
+type contactDetails struct {
+	JID          types.JID `json:"jid"`
+	OnWhatsApp   bool      `json:"on_whatsapp"`
+	FullName     string    `json:"full_name,omitempty"`
+	FirstName    string    `json:"first_name,omitempty"`
+	PushName     string    `json:"push_name,omitempty"`
+	BusinessName string    `json:"business_name,omitempty"`
+	VerifiedName string    `json:"verified_name,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	Devices      int       `json:"devices,omitempty"`
+	// Picture is "set", "hidden" or "none"; PictureURL is only filled in
+	// when it is set.
+	Picture    string `json:"picture"`
+	PictureURL string `json:"picture_url,omitempty"`
+}
+
+// lookupContact gathers a user's stored names, registration, about text and
+// profile picture. The client must be connected.
+func lookupContact(client *whatsappclient.Client, jid types.JID) (*contactDetails, error) {
+	details := &contactDetails{JID: jid, Picture: "none"}
+
+	lookup, err := client.LookupPhone(jid.User)
+	if err != nil {
+		return nil, err
+	}
+	details.OnWhatsApp = lookup.Registered
+	if lookup.Registered {
+		details.JID = lookup.JID
+	}
+
+	contact, err := client.Store.Contacts.GetContact(details.JID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load contact: %v", err)
+	}
+	details.FullName = contact.FullName
+	details.FirstName = contact.FirstName
+	details.PushName = contact.PushName
+	details.BusinessName = contact.BusinessName
+
+	if !details.OnWhatsApp {
+		return details, nil
+	}
+
+	users, err := client.GetUserInfo([]types.JID{details.JID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user info: %v", err)
+	}
+	if info, ok := users[details.JID]; ok {
+		details.Status = info.Status
+		details.Devices = len(info.Devices)
+		if info.VerifiedName != nil {
+			details.VerifiedName = info.VerifiedName.Details.GetVerifiedName()
+		}
+	}
+
+	picture, err := client.GetProfilePictureInfo(details.JID, nil)
+	switch {
+	case errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized):
+		details.Picture = "hidden"
+	case errors.Is(err, whatsmeow.ErrProfilePictureNotSet):
+	case err != nil:
+		return nil, fmt.Errorf("failed to get profile picture: %v", err)
+	case picture != nil:
+		details.Picture, details.PictureURL = "set", picture.URL
+	}
+	return details, nil
+}
+
+func printContactDetails(d *contactDetails) {
+	// orNone marks fields we have no value for, which for the about text
+	// usually means the user only shares it with their contacts
+	orNone := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	fmt.Printf("JID:           %s\n", d.JID.String())
+	fmt.Printf("On WhatsApp:   %t\n", d.OnWhatsApp)
+	fmt.Printf("Full name:     %s\n", orNone(d.FullName))
+	fmt.Printf("First name:    %s\n", orNone(d.FirstName))
+	fmt.Printf("Push name:     %s\n", orNone(d.PushName))
+	fmt.Printf("Business name: %s\n", orNone(d.BusinessName))
+	if !d.OnWhatsApp {
+		return
+	}
+	fmt.Printf("Verified name: %s\n", orNone(d.VerifiedName))
+	fmt.Printf("About:         %s\n", orNone(d.Status))
+	fmt.Printf("Devices:       %d\n", d.Devices)
+	switch d.Picture {
+	case "set":
+		fmt.Printf("Picture:       %s\n", d.PictureURL)
+	case "hidden":
+		fmt.Println("Picture:       hidden by the user's privacy settings")
+	default:
+		fmt.Println("Picture:       none")
+	}
+}
+
+func showContact(args []string) error {
+	fs := newFlagSet("contact")
+	asJSON := fs.Bool("json", false, "print the contact as JSON")
+	args = parseCommandFlags(fs, args)
+
+	if len(args) != 1 {
+		fmt.Println("Usage: contact <phone|jid|me> [--json]")
+		return errUsage
+	}
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return err
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	// Resolve "me" but leave phone numbers to lookupContact, which reports
+	// unregistered numbers instead of failing on them
+	var jid types.JID
+	if whatsappclient.IsSelf(args[0]) {
+		jid, err = client.ResolveRecipient(args[0])
+	} else {
+		jid, err = whatsappclient.ParseRecipient(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if jid.Server != types.DefaultUserServer {
+		return fmt.Errorf("%s is not a user JID", jid.String())
+	}
+
+	details, err := lookupContact(client, jid)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(details, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printContactDetails(details)
+	return nil
+}
+
+// showStatusText prints the about text of one or more users, fetched in a
+// single query.
+func showStatusText(ctx context.Context, args []string) error {
+	args = parseCommandFlags(newFlagSet("status-text"), args)
+
+	recipients := splitRecipients(args)
+	if len(recipients) == 0 {
+		fmt.Println("Usage: status-text <phone|jid|me>...")
+		return errUsage
+	}
+	for _, r := range recipients {
+		if err := whatsappclient.ValidateRecipient(r); err != nil {
+			return err
+		}
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	// Numbers not on WhatsApp are reported rather than failing the batch
+	var jids []types.JID
+	for _, r := range recipients {
+		jid, err := client.ResolveRecipient(r)
+		if errors.Is(err, whatsappclient.ErrNotOnWhatsApp) {
+			fmt.Printf("%s: not on WhatsApp\n", r)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if jid.Server != types.DefaultUserServer {
+			return fmt.Errorf("%s is not a user JID", jid.String())
+		}
+		jids = append(jids, jid)
+	}
+	if len(jids) == 0 {
+		return nil
+	}
+
+	abouts, err := client.GetAbout(ctx, jids)
+	if err != nil {
+		return err
+	}
+	for _, jid := range jids {
+		about, ok := abouts[jid.ToNonAD()]
+		switch {
+		case !ok:
+			fmt.Printf("%s: not on WhatsApp\n", jid.String())
+		case about.Hidden:
+			fmt.Printf("%s: (hidden by their privacy settings)\n", jid.String())
+		case about.Text == "":
+			// An about shared only with contacts usually comes back empty
+			// rather than as an error
+			fmt.Printf("%s: (none, or hidden by their privacy settings)\n", jid.String())
+		case about.SetAt.IsZero():
+			fmt.Printf("%s: %s\n", jid.String(), about.Text)
+		default:
+			fmt.Printf("%s: %s (set %s)\n", jid.String(), about.Text, about.SetAt.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// deadlineGrace is how long a command may take to wind down once the
+// deadline has cancelled it before the process exits anyway.
+const deadlineGrace = 10 * time.Second
+
+// deadline is the --deadline setting: the longest a command may run.
+var deadline string
+
+var (
+	// cancelCommand cancels the context main passes to commands
+	cancelCommand context.CancelFunc
+	deadlineOnce  sync.Once
+	deadlineHit   atomic.Bool
+)
+
+// withDeadline returns a context that --deadline cancels once it passes.
+func withDeadline(ctx context.Context) context.Context {
+	ctx, cancelCommand = context.WithCancel(ctx)
+	return ctx
+}
+
+// startDeadline arms the --deadline timer. It runs from parseCommandFlags,
+// so only the first command parsed, not ones typed into the REPL, starts it.
+func startDeadline() error {
+	if deadline == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(deadline)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid --deadline %q: want a positive duration like 10m", deadline)
+	}
+	deadlineOnce.Do(func() {
+		time.AfterFunc(d, expireDeadline)
+	})
+	return nil
+}
+
+// expireDeadline cancels the running command. Commands that wait on the
+// context return and close their stores as usual; the rest get
+// deadlineGrace before the store is saved, the client closed and the
+// process exits.
+func expireDeadline() {
+	deadlineHit.Store(true)
+	if cancelCommand != nil {
+		cancelCommand()
+	}
+
+	time.AfterFunc(deadlineGrace, func() {
+		fmt.Printf("Error: deadline of %s exceeded\n", deadline)
+		if client := openedClient.Load(); client != nil {
+			if err := client.SaveStore(); err != nil {
+				fmt.Printf("Error saving to database: %v\n", err)
+			}
+			client.Close()
+		}
+		os.Exit(exitDeadline)
+	})
+}
+
+// deadlineError replaces a command's result once the deadline has passed,
+// since whatever it returned was caused by the cancellation.
+func deadlineError(err error) error {
+	if !deadlineHit.Load() {
+		return err
+	}
+	return withExitCode(exitDeadline, fmt.Errorf("deadline of %s exceeded", deadline))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+)
+
+// parseNode decodes a node from its JSON description, e.g.
+// {"Tag": "presence", "Attrs": {"type": "available"}}, or from WhatsApp's
+// binary XML encoding when the input isn't a JSON object.
+func parseNode(data []byte) (*waBinary.Node, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var node waBinary.Node
+		if err := json.Unmarshal(trimmed, &node); err != nil {
+			return nil, fmt.Errorf("invalid JSON node: %v", err)
+		}
+		if node.Tag == "" {
+			return nil, fmt.Errorf("JSON node has no Tag")
+		}
+		return &node, nil
+	}
+
+	node, err := waBinary.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid binary node: %v", err)
+	}
+	return node, nil
+}
+
+// debugSendNode sends a raw node over the connection, for experimenting with
+// stanzas whatsmeow has no helper for. It is deliberately left out of the help.
+func debugSendNode(args []string) error {
+	fs := newFlagSet("debug-send-node")
+	enabled := fs.Bool("enable-dangerous", false, "confirm sending an unvalidated raw node")
+	args = parseCommandFlags(fs, args)
+
+	if len(args) != 1 {
+		fmt.Println("Usage: debug-send-node --enable-dangerous <file|->")
+		fmt.Println("The file holds a JSON node description or a binary XML node; - reads stdin.")
+		return errUsage
+	}
+
+	if !*enabled {
+		return fmt.Errorf("debug-send-node sends raw stanzas that can break the session or get the account banned; pass --enable-dangerous to confirm")
+	}
+
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read node: %v", err)
+	}
+
+	node, err := parseNode(data)
+	if err != nil {
+		return err
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	fmt.Println("Sending node:")
+	fmt.Println(node.XMLString())
+	//lint:ignore SA1019 raw node access is the point of this command
+	if err := client.DangerousInternals().SendNode(*node); err != nil {
+		return withExitCode(exitSendFailure, fmt.Errorf("failed to send node: %v", err))
+	}
+	fmt.Println("Node sent")
+	return nil
+}
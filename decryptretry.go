@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+const (
+	// retryRequestDelay gives the sender time to answer the retry receipt
+	// whatsmeow sends it before the phone is asked instead.
+	retryRequestDelay = 5 * time.Second
+	// maxRetryRequests caps phone re-requests per minute, so a session
+	// desync that breaks every message doesn't turn into a request storm.
+	maxRetryRequests = 10
+)
+
+// retryRequester recovers messages that arrived undecryptable. whatsmeow
+// already answers each one with a retry receipt asking the sender to
+// re-encrypt (up to five times a message), but the event doesn't carry the
+// stanza needed to send more. What it adds is asking our own phone, which
+// decrypted the message, to resend it if the sender hasn't within
+// retryRequestDelay.
+type retryRequester struct {
+	client *whatsappclient.Client
+
+	lock    sync.Mutex
+	pending map[types.MessageID]context.CancelFunc
+	sent    []time.Time
+}
+
+func newRetryRequester(client *whatsappclient.Client) *retryRequester {
+	return &retryRequester{client: client, pending: make(map[types.MessageID]context.CancelFunc)}
+}
+
+// undecryptable schedules a re-request for the message in v. A nil r, as
+// without --request-retries, does nothing.
+func (r *retryRequester) undecryptable(ctx context.Context, v *events.UndecryptableMessage) {
+	if r == nil {
+		return
+	}
+	info := v.Info
+	reason := "could not be decrypted"
+	if v.IsUnavailable {
+		reason = "was not encrypted for this device"
+	}
+	fmt.Printf("[Retry] Message %s from %s %s; waiting for the sender to resend it\n", info.ID, formatSource(info.MessageSource), reason)
+
+	r.lock.Lock()
+	if _, ok := r.pending[info.ID]; ok {
+		r.lock.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r.pending[info.ID] = cancel
+	r.lock.Unlock()
+
+	go func() {
+		defer r.done(info.ID)
+		if sleepContext(ctx, retryRequestDelay) != nil {
+			return
+		}
+		if !r.allow(time.Now()) {
+			fmt.Printf("[Retry] Not asking the phone for %s: over %d requests a minute\n", info.ID, maxRetryRequests)
+			return
+		}
+		r.requestFromPhone(ctx, info)
+	}()
+}
+
+// received cancels a pending re-request once the message comes through.
+func (r *retryRequester) received(id types.MessageID) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	cancel, ok := r.pending[id]
+	r.lock.Unlock()
+	if ok {
+		fmt.Printf("[Retry] Message %s was resent\n", id)
+		cancel()
+	}
+}
+
+func (r *retryRequester) done(id types.MessageID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if cancel, ok := r.pending[id]; ok {
+		cancel()
+		delete(r.pending, id)
+	}
+}
+
+// allow reports whether another request fits in the last minute's budget,
+// and counts it if so.
+func (r *retryRequester) allow(now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for len(r.sent) > 0 && now.Sub(r.sent[0]) >= time.Minute {
+		r.sent = r.sent[1:]
+	}
+	if len(r.sent) >= maxRetryRequests {
+		return false
+	}
+	r.sent = append(r.sent, now)
+	return true
+}
+
+func (r *retryRequester) requestFromPhone(ctx context.Context, info types.MessageInfo) {
+	own := r.client.Store.ID
+	if own == nil {
+		return
+	}
+	req := r.client.BuildUnavailableMessageRequest(info.Chat, info.Sender, info.ID)
+	if _, err := r.client.SendMessage(ctx, own.ToNonAD(), req, whatsmeow.SendRequestExtra{Peer: true}); err != nil {
+		fmt.Printf("[Retry] Failed to ask the phone for %s: %v\n", info.ID, err)
+		return
+	}
+	fmt.Printf("[Retry] Asked the phone to resend message %s from %s\n", info.ID, formatSource(info.MessageSource))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"container/list"
+	"database/sql"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// dedupOptions holds the listener's duplicate-suppression flags.
+type dedupOptions struct {
+	size    int
+	window  time.Duration
+	persist bool
+}
+
+func (o *dedupOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.size, "dedup-size", 1000, "remember this many recent message IDs to skip redeliveries (0 = off)")
+	fs.DurationVar(&o.window, "dedup-window", 10*time.Minute, "skip a message ID seen again within this long")
+	fs.BoolVar(&o.persist, "dedup-persist", false, "keep the recent message IDs in the session database, so redeliveries after a restart are skipped too")
+}
+
+func (o *dedupOptions) validate() error {
+	if o.size < 0 {
+		return fmt.Errorf("--dedup-size must not be negative")
+	}
+	if o.window <= 0 {
+		return fmt.Errorf("--dedup-window must be positive")
+	}
+	if o.persist && o.size == 0 {
+		return fmt.Errorf("--dedup-persist needs a non-zero --dedup-size")
+	}
+	return nil
+}
+
+const seenMessagesSchema = `CREATE TABLE IF NOT EXISTS seen_messages (
+	chat    TEXT    NOT NULL,
+	id      TEXT    NOT NULL,
+	seen_at INTEGER NOT NULL,
+	PRIMARY KEY (chat, id)
+)`
+
+// seenKey identifies a message. IDs are only unique per chat.
+type seenKey struct {
+	chat string
+	id   string
+}
+
+type seenEntry struct {
+	key  seenKey
+	seen time.Time
+}
+
+// messageDeduper is an LRU of recently handled message IDs. WhatsApp can
+// deliver a message again after a reconnect or a retry receipt, and
+// everything downstream of the listener should see it only once.
+type messageDeduper struct {
+	size   int
+	window time.Duration
+	db     *sql.DB
+
+	lock    sync.Mutex
+	order   *list.List // of *seenEntry, most recent first
+	entries map[seenKey]*list.Element
+}
+
+// newMessageDeduper returns nil when deduplication is off. With persist,
+// the IDs seen within the window are loaded from and saved to dbPath.
+func newMessageDeduper(o dedupOptions, dbPath string) (*messageDeduper, error) {
+	if o.size == 0 {
+		return nil, nil
+	}
+	d := &messageDeduper{
+		size:    o.size,
+		window:  o.window,
+		order:   list.New(),
+		entries: make(map[seenKey]*list.Element),
+	}
+	if !o.persist {
+		return d, nil
+	}
+
+	db, err := clientOptions.DB.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dedup store: %v", err)
+	}
+	if _, err := db.Exec(seenMessagesSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create seen_messages table: %v", err)
+	}
+	d.db = db
+
+	cutoff := time.Now().Add(-o.window).Unix()
+	if _, err := db.Exec(`DELETE FROM seen_messages WHERE seen_at < ?`, cutoff); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("failed to prune seen messages: %v", err)
+	}
+	rows, err := db.Query(`SELECT chat, id, seen_at FROM seen_messages ORDER BY seen_at DESC LIMIT ?`, o.size)
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("failed to load seen messages: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e seenEntry
+		var seenAt int64
+		if err := rows.Scan(&e.key.chat, &e.key.id, &seenAt); err != nil {
+			d.Close()
+			return nil, fmt.Errorf("failed to load seen messages: %v", err)
+		}
+		e.seen = time.Unix(seenAt, 0)
+		d.entries[e.key] = d.order.PushBack(&e)
+	}
+	return d, rows.Err()
+}
+
+// seen records the message and reports whether it was already handled
+// within the window. A nil deduper sees nothing twice.
+func (d *messageDeduper) seen(chat types.JID, id string, now time.Time) bool {
+	if d == nil {
+		return false
+	}
+	key := seenKey{chat: chat.String(), id: id}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if el, ok := d.entries[key]; ok {
+		e := el.Value.(*seenEntry)
+		if now.Sub(e.seen) <= d.window {
+			return true
+		}
+		// Seen too long ago to count; treat it as new
+		e.seen = now
+		d.order.MoveToFront(el)
+	} else {
+		d.entries[key] = d.order.PushFront(&seenEntry{key: key, seen: now})
+		for d.order.Len() > d.size {
+			oldest := d.order.Back()
+			delete(d.entries, oldest.Value.(*seenEntry).key)
+			d.order.Remove(oldest)
+		}
+	}
+
+	if d.db != nil {
+		if _, err := d.db.Exec(`INSERT OR REPLACE INTO seen_messages (chat, id, seen_at) VALUES (?, ?, ?)`, key.chat, key.id, now.Unix()); err != nil {
+			fmt.Printf("Error: failed to record seen message: %v\n", err)
+		}
+	}
+	return false
+}
+
+func (d *messageDeduper) Close() error {
+	if d == nil || d.db == nil {
+		return nil
+	}
+	return d.db.Close()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// linkedDevice is a row of the devices listing. WhatsApp only tells linked
+// devices the primary phone's platform, so other devices have none.
+type linkedDevice struct {
+	JID      string `json:"jid"`
+	Device   uint16 `json:"device"`
+	Role     string `json:"role"`
+	Platform string `json:"platform,omitempty"`
+}
+
+func describeDevices(client *whatsappclient.Client, devices []types.JID) []linkedDevice {
+	rows := make([]linkedDevice, len(devices))
+	for i, jid := range devices {
+		row := linkedDevice{JID: jid.String(), Device: jid.Device, Role: "linked device"}
+		switch jid.Device {
+		case 0:
+			row.Role, row.Platform = "primary phone", client.Store.Platform
+		case client.Store.ID.Device:
+			row.Role = "this device"
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// parseDeviceArg reads the device to remove: a device JID as listed, or
+// just its device number.
+func parseDeviceArg(client *whatsappclient.Client, value string) (types.JID, error) {
+	if n, err := strconv.ParseUint(value, 10, 16); err == nil {
+		return types.JID{User: client.Store.ID.User, Device: uint16(n), Server: types.DefaultUserServer}, nil
+	}
+	jid, err := types.ParseJID(value)
+	if err != nil || !strings.Contains(value, "@") {
+		return types.JID{}, fmt.Errorf("invalid device %q: want a device JID or number as shown by devices", value)
+	}
+	return jid, nil
+}
+
+// manageDevices implements "devices" and "devices remove <device>".
+func manageDevices(ctx context.Context, args []string) error {
+	fs := newFlagSet("devices")
+	asJSON := fs.Bool("json", false, "print the devices as JSON")
+	yes := fs.Bool("yes", false, "with remove, allow removing this device, which logs it out")
+	args = parseCommandFlags(fs, args)
+
+	remove := len(args) == 2 && args[0] == "remove"
+	if len(args) != 0 && !remove {
+		fmt.Println("Usage: devices [--json] | devices remove <device-jid|device-number>")
+		return errUsage
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if remove {
+		device, err := parseDeviceArg(client, args[1])
+		if err != nil {
+			return err
+		}
+		if device.User == client.Store.ID.User && device.Device == client.Store.ID.Device && !*yes {
+			return fmt.Errorf("%s is the device this CLI is logged in as; removing it logs out and deletes the session, so pass --yes to confirm", device.String())
+		}
+		if err := client.RemoveLinkedDevice(ctx, device); err != nil {
+			if device.Device != client.Store.ID.Device && device.Device != 0 {
+				err = fmt.Errorf("%v (WhatsApp may only accept this from the primary phone; use Linked devices there instead)", err)
+			}
+			return err
+		}
+		if device.Device == client.Store.ID.Device {
+			fmt.Printf("Logged out and unlinked this device (%s)\n", device.String())
+		} else {
+			fmt.Printf("Unlinked device %d (%s)\n", device.Device, device.String())
+		}
+		return nil
+	}
+
+	devices, err := client.LinkedDevices(ctx)
+	if err != nil {
+		return err
+	}
+	rows := describeDevices(client, devices)
+
+	if *asJSON {
+		data, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Devices of %s (%d):\n", client.Store.ID.User, len(rows))
+	for _, row := range rows {
+		role := row.Role
+		if row.Platform != "" {
+			role += " (" + row.Platform + ")"
+		}
+		fmt.Printf("  %-4d %-36s %s\n", row.Device, row.JID, role)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// downloadableFrom returns the media part of msg along with its MIME type
+// and, for documents, the original file name.
+func downloadableFrom(msg *waE2E.Message) (whatsmeow.DownloadableMessage, string, string, error) {
+	if img := msg.GetImageMessage(); img != nil {
+		return img, img.GetMimetype(), "", nil
+	} else if video := msg.GetVideoMessage(); video != nil {
+		return video, video.GetMimetype(), "", nil
+	} else if audio := msg.GetAudioMessage(); audio != nil {
+		return audio, audio.GetMimetype(), "", nil
+	} else if doc := msg.GetDocumentMessage(); doc != nil {
+		return doc, doc.GetMimetype(), doc.GetFileName(), nil
+	} else if sticker := msg.GetStickerMessage(); sticker != nil {
+		return sticker, sticker.GetMimetype(), "", nil
+	}
+	return nil, "", "", fmt.Errorf("message has no downloadable media")
+}
+
+// preferredExtensions overrides mime.ExtensionsByType, which returns
+// extensions alphabetically (".jfif" before ".jpg").
+var preferredExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"video/mp4":  ".mp4",
+	"audio/ogg":  ".ogg",
+	"audio/mpeg": ".mp3",
+}
+
+// extensionFor returns the file extension for a MIME type such as
+// "audio/ogg; codecs=opus", or "" if unknown.
+func extensionFor(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+	if ext, ok := preferredExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// defaultDownloadPath names a downloaded file after the message ID, or the
+// original file name for documents.
+func defaultDownloadPath(id, mimeType, fileName string) string {
+	// The file name comes from the sender, so never let it pick a directory
+	if name := filepath.Base(fileName); fileName != "" && name != "." && name != "/" {
+		return name
+	}
+	return id + extensionFor(mimeType)
+}
+
+// isMediaExpired reports whether a download error means the media is no
+// longer on WhatsApp's servers.
+func isMediaExpired(err error) bool {
+	return errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410)
+}
+
+func downloadMedia(args []string) error {
+	fs := newFlagSet("download")
+	out := fs.String("out", "", "path to save the media to, replacing any file there (default: the document's name or the message ID, numbered if taken)")
+	storePath := bindSetting(fs, messagesDBSetting)
+	args = parseCommandFlags(fs, args, storePath)
+
+	if len(args) != 2 {
+		fmt.Println("Usage: download <chat> <message-id> [--out <path>]")
+		return errUsage
+	}
+
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to set up client: %v", err)
+	}
+
+	chat, err := client.ResolveRecipient(args[0])
+	if err != nil {
+		return err
+	}
+
+	store, err := openMessageStore(messageStorePath(client.DBPath))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	stored, err := store.Get(chat, args[1])
+	if errors.Is(err, errMessageNotFound) {
+		return fmt.Errorf("message %s in %s is not in the local store. Run 'go run . message --store-messages' to record messages as they arrive", args[1], chat.String())
+	} else if err != nil {
+		return err
+	}
+
+	media, mimeType, fileName, err := downloadableFrom(stored.Message)
+	if err != nil {
+		return err
+	}
+
+	if err := connectAndWait(client); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	data, err := client.Download(media)
+	if isMediaExpired(err) {
+		return fmt.Errorf("media for message %s has expired and is no longer available on WhatsApp's servers", args[1])
+	} else if err != nil {
+		return fmt.Errorf("failed to download media: %v", err)
+	}
+
+	// The default name comes from the sender, so it never replaces an
+	// existing file; --out is the caller's choice and is written as given
+	path := *out
+	if path == "" {
+		path, err = writeExclusive(defaultDownloadPath(stored.ID, mimeType, fileName), data, true)
+	} else {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save media: %v", err)
+	}
+
+	fmt.Printf("Saved %d bytes to %s\n", len(data), path)
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// disappearingTimers are the timer values WhatsApp accepts, by the names
+// used on the command line.
+var disappearingTimers = map[string]time.Duration{
+	"off": whatsmeow.DisappearingTimerOff,
+	"24h": whatsmeow.DisappearingTimer24Hours,
+	"7d":  whatsmeow.DisappearingTimer7Days,
+	"90d": whatsmeow.DisappearingTimer90Days,
+}
+
+// ephemeralOptions holds the disappearing-message flags of the send commands.
+type ephemeralOptions struct {
+	value     string
+	chatTimer bool
+	timer     time.Duration
+}
+
+func (o *ephemeralOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.value, "ephemeral", "", "send as a disappearing message: 24h, 7d, 90d or off")
+	fs.BoolVar(&o.chatTimer, "set-chat-timer", false, "also set the chat's disappearing-messages timer to the --ephemeral value")
+}
+
+// validate parses --ephemeral before connecting.
+func (o *ephemeralOptions) validate() error {
+	if o.value == "" {
+		if o.chatTimer {
+			return fmt.Errorf("--set-chat-timer requires --ephemeral")
+		}
+		return nil
+	}
+	timer, ok := disappearingTimers[o.value]
+	if !ok {
+		return fmt.Errorf("invalid --ephemeral %q: must be 24h, 7d, 90d or off", o.value)
+	}
+	o.timer = timer
+	return nil
+}
+
+// check fails if msg can't carry the --ephemeral expiration, so a send can
+// be refused before it changes anything.
+func (o *ephemeralOptions) check(msg *waE2E.Message) error {
+	if o.timer == 0 || msg.Conversation != nil || contextInfoOf(msg) != nil {
+		return nil
+	}
+	return fmt.Errorf("this message type can't be sent as a disappearing message")
+}
+
+// apply sets the chat timer if requested and marks msg with the expiration.
+func (o *ephemeralOptions) apply(client messenger, recipient string, msg *waE2E.Message) error {
+	if o.value == "" {
+		return nil
+	}
+	// Refuse before the chat timer is touched
+	if err := o.check(msg); err != nil {
+		return err
+	}
+
+	if o.chatTimer {
+		chat, err := client.ResolveRecipient(recipient)
+		if err != nil {
+			return err
+		}
+		if err := client.SetDisappearingTimer(chat, o.timer); err != nil {
+			return fmt.Errorf("failed to set disappearing timer: %v", err)
+		}
+		fmt.Printf("Disappearing messages in %s set to %s\n", chat.String(), o.value)
+	}
+
+	if o.timer == 0 {
+		return nil
+	}
+	if err := setExpiration(msg, o.timer); err != nil {
+		return err
+	}
+	fmt.Printf("Message will disappear after %s\n", o.value)
+	return nil
+}
+
+// setExpiration stores the disappearing timer in the message's ContextInfo.
+// A plain text message is converted to an extended text message, since
+// Conversation has no ContextInfo.
+func setExpiration(msg *waE2E.Message, timer time.Duration) error {
+	if msg.Conversation != nil {
+		msg.ExtendedTextMessage = &waE2E.ExtendedTextMessage{Text: msg.Conversation}
+		msg.Conversation = nil
+	}
+	ctxInfo := contextInfoOf(msg)
+	if ctxInfo == nil {
+		return fmt.Errorf("this message type can't be sent as a disappearing message")
+	}
+
+	if *ctxInfo == nil {
+		*ctxInfo = &waE2E.ContextInfo{}
+	}
+	(*ctxInfo).Expiration = proto.Uint32(uint32(timer.Seconds()))
+	return nil
+}
+
+// contextInfoOf returns where msg keeps its ContextInfo, or nil for
+// message types that have none.
+func contextInfoOf(msg *waE2E.Message) **waE2E.ContextInfo {
+	switch {
+	case msg.ExtendedTextMessage != nil:
+		return &msg.ExtendedTextMessage.ContextInfo
+	case msg.ImageMessage != nil:
+		return &msg.ImageMessage.ContextInfo
+	case msg.VideoMessage != nil:
+		return &msg.VideoMessage.ContextInfo
+	case msg.AudioMessage != nil:
+		return &msg.AudioMessage.ContextInfo
+	case msg.DocumentMessage != nil:
+		return &msg.DocumentMessage.ContextInfo
+	case msg.StickerMessage != nil:
+		return &msg.StickerMessage.ContextInfo
+	case msg.LocationMessage != nil:
+		return &msg.LocationMessage.ContextInfo
+	case msg.ContactMessage != nil:
+		return &msg.ContactMessage.ContextInfo
+	case msg.ContactsArrayMessage != nil:
+		return &msg.ContactsArrayMessage.ContextInfo
+	}
+	return nil
+}
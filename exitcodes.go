@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Process exit codes, so scripts can tell failures apart.
+const (
+	exitOK             = 0
+	exitGeneric        = 1
+	exitNotLoggedIn    = 2
+	exitConnectFailure = 3
+	exitSendFailure    = 4
+	exitTemporaryBan   = 5
+	// exitDeadline matches GNU timeout
+	exitDeadline = 124
+)
+
+// errUsage is returned by a command after it has printed its usage. It exits
+// with exitGeneric without printing anything further.
+var errUsage = errors.New("invalid usage")
+
+// exitError attaches an exit code to a command's error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode tags err with an exit code. A nil err stays nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCodeFor returns the exit code for a command's error.
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitGeneric
+}
+
+// printExitCodes lists the exit codes in the help output.
+func printExitCodes() {
+	fmt.Println("\nExit codes:")
+	fmt.Println("  0    Success")
+	fmt.Println("  1    Error or invalid usage")
+	fmt.Println("  2    Not logged in (run 'qr' first)")
+	fmt.Println("  3    Could not connect, or the connection was rejected")
+	fmt.Println("  4    A message could not be sent")
+	fmt.Println("  5    The account is temporarily banned")
+	fmt.Println("  124  The --deadline passed before the command finished")
+}
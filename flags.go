@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+)
+
+// parseFlags parses args with fs, allowing flags to appear before, between
+// or after positional arguments, and returns the positional arguments.
+// Negative numbers (e.g. a longitude) are treated as positional unless they
+// are a flag's value, and a literal "--" ends flag parsing.
+//
+// The flags are picked out first and parsed in one go, since fs.Parse
+// stops at the first positional argument and would read a negative number
+// after it as an undefined flag.
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" || isNumber(arg) {
+			positional = append(positional, arg)
+			continue
+		}
+
+		flags = append(flags, arg)
+		// A value not given with = is the next argument, for flags that take one
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := fs.Lookup(name); f != nil && !isBoolFlag(f) && i+1 < len(args) {
+			flags = append(flags, args[i+1])
+			i++
+		}
+	}
+	fs.Parse(flags)
+	return positional
+}
+
+// isBoolFlag reports whether f is set by its name alone, like a bool flag.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// repeatedFlag collects every value of a flag given more than once.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		wantPositional []string
+		wantEphemeral  string
+		wantDryRun     bool
+		wantRate       int
+	}{
+		{name: "no flags", args: []string{"1555", "-33.8", "151.2"},
+			wantPositional: []string{"1555", "-33.8", "151.2"}},
+		{name: "flags first", args: []string{"--ephemeral", "24h", "1555", "-33.8", "151.2"},
+			wantPositional: []string{"1555", "-33.8", "151.2"}, wantEphemeral: "24h"},
+		{name: "flag in the middle", args: []string{"1555", "--ephemeral", "24h", "-33.8", "151.2"},
+			wantPositional: []string{"1555", "-33.8", "151.2"}, wantEphemeral: "24h"},
+		{name: "flags between negatives", args: []string{"1555", "-33.8", "--dry-run", "-151.2", "--rate=5", "Home"},
+			wantPositional: []string{"1555", "-33.8", "-151.2", "Home"}, wantDryRun: true, wantRate: 5},
+		{name: "negative flag value", args: []string{"--rate", "-1", "1555", "-33.8"},
+			wantPositional: []string{"1555", "-33.8"}, wantRate: -1},
+		{name: "flags last", args: []string{"1555", "-33.8", "151.2", "-dry-run", "-ephemeral=7d"},
+			wantPositional: []string{"1555", "-33.8", "151.2"}, wantEphemeral: "7d", wantDryRun: true},
+		{name: "stdin and terminator", args: []string{"1555", "-", "--", "--dry-run", "-x"},
+			wantPositional: []string{"1555", "-", "--dry-run", "-x"}},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		ephemeral := fs.String("ephemeral", "", "")
+		dryRun := fs.Bool("dry-run", false, "")
+		rate := fs.Int("rate", 0, "")
+
+		got := parseFlags(fs, tt.args)
+		if !reflect.DeepEqual(got, tt.wantPositional) {
+			t.Errorf("%s: positional = %q, want %q", tt.name, got, tt.wantPositional)
+		}
+		if *ephemeral != tt.wantEphemeral || *dryRun != tt.wantDryRun || *rate != tt.wantRate {
+			t.Errorf("%s: flags = (%q, %v, %d), want (%q, %v, %d)", tt.name, *ephemeral, *dryRun, *rate, tt.wantEphemeral, tt.wantDryRun, tt.wantRate)
+		}
+	}
+}
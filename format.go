@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// formatter renders received messages for the listener, pull and the REPL.
+// Each Format result is complete, trailing newline included.
+type formatter interface {
+	Format(msg whatsappclient.Event) string
+}
+
+// headerFormatter is a formatter whose output starts with a header, written
+// once at the top of stdout and of a new --output file.
+type headerFormatter interface {
+	formatter
+	Header() string
+}
+
+// formatters builds each --format by name. color is only honoured by the
+// formats meant for a terminal.
+var formatters = map[string]func(color bool) formatter{
+	"text":    func(color bool) formatter { return textFormatter{color: color} },
+	"compact": func(color bool) formatter { return compactFormatter{color: color} },
+	"json":    func(bool) formatter { return jsonFormatter{} },
+	"csv":     func(bool) formatter { return csvFormatter{} },
+}
+
+func formatterNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// textFormatter is the multi-line block, with the header coloured per chat.
+type textFormatter struct {
+	color bool
+}
+
+func (f textFormatter) Format(msg whatsappclient.Event) string {
+	// Get chat info
+	chatInfo := "Private Message"
+	if msg.IsGroup {
+		chatInfo = "Group Message"
+	}
+
+	header, body := "", ""
+	if f.color {
+		header = chatColor(msg.Chat)
+		// Our own messages are dimmed throughout so replies stand apart
+		// from what was received
+		if msg.IsFromMe {
+			header, body = ansiDim, ansiDim
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s\n", paint(header, "=== New Message ==="))
+	fmt.Fprintf(&b, "%s\n", paint(header, "From: "+senderLabel(msg)))
+	fmt.Fprintf(&b, "%s\n", paint(body, "Type: "+chatInfo))
+	if msg.IsGroup {
+		fmt.Fprintf(&b, "%s\n", paint(header, "Group: "+formatJID(msg.Chat)))
+	}
+	fmt.Fprintf(&b, "%s\n", paint(body, "Time: "+msg.Timestamp.Local().Format("2006-01-02 15:04:05")))
+	fmt.Fprintf(&b, "%s\n", paint(body, "Content: "+msg.Content))
+	fmt.Fprintf(&b, "%s\n", paint(header, "================="))
+	return b.String()
+}
+
+// compactWidth is how much of a message's content a compact line shows.
+const compactWidth = 100
+
+// compactFormatter renders one grep-friendly line per message:
+// "HH:MM:SS [chat] sender: content", with newlines in the content folded
+// into spaces and long content cut short with an ellipsis.
+type compactFormatter struct {
+	color bool
+}
+
+func (f compactFormatter) Format(msg whatsappclient.Event) string {
+	content := strings.Join(strings.Fields(msg.Content), " ")
+	if runes := []rune(content); len(runes) > compactWidth {
+		content = string(runes[:compactWidth-1]) + "…"
+	}
+
+	style := ""
+	if f.color {
+		style = chatColor(msg.Chat)
+		if msg.IsFromMe {
+			style = ansiDim
+		}
+	}
+	prefix := fmt.Sprintf("[%s] %s:", formatJID(msg.Chat), senderLabel(msg))
+	return fmt.Sprintf("%s %s %s\n", msg.Timestamp.Local().Format("15:04:05"), paint(style, prefix), content)
+}
+
+// jsonFormatter writes each message as a JSON line.
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(msg whatsappclient.Event) string {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Sprintf("{\"error\": %q}\n", err.Error())
+	}
+	return string(data) + "\n"
+}
+
+// csvColumns are the fields of csvFormatter's rows, named like the JSON
+// keys.
+var csvColumns = []string{"timestamp", "chat", "id", "sender", "sender_name", "is_from_me", "is_group", "type", "content"}
+
+// csvFormatter writes a CSV row per message, for spreadsheets.
+type csvFormatter struct{}
+
+func (csvFormatter) Header() string {
+	return csvLine(csvColumns)
+}
+
+func (csvFormatter) Format(msg whatsappclient.Event) string {
+	return csvLine([]string{
+		msg.Timestamp.Format(time.RFC3339),
+		msg.Chat.String(),
+		msg.ID,
+		msg.Sender.String(),
+		msg.SenderName,
+		fmt.Sprint(msg.IsFromMe),
+		fmt.Sprint(msg.IsGroup),
+		msg.Type,
+		msg.Content,
+	})
+}
+
+func csvLine(fields []string) string {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(fields)
+	w.Flush()
+	return b.String()
+}
+
+// formatOptions are the output flags shared by the commands that print
+// received messages. --json, --compact and --no-color predate --format and
+// are kept as shorthands.
+type formatOptions struct {
+	name    string
+	asJSON  bool
+	compact bool
+	noColor bool
+}
+
+// register adds the flags to fs, with def as the default --format.
+func (o *formatOptions) register(fs *flag.FlagSet, def string) {
+	fs.StringVar(&o.name, "format", def, "how to print messages: "+strings.Join(formatterNames(), ", "))
+	fs.BoolVar(&o.asJSON, "json", false, "print each message as a JSON line (same as --format json)")
+	fs.BoolVar(&o.compact, "compact", false, "print each message on one line: time, chat, sender and truncated content (same as --format compact)")
+	fs.BoolVar(&o.noColor, "no-color", false, "don't colour message headers per chat (off anyway when stdout isn't a terminal)")
+}
+
+// build returns the formatter for stdout and the uncoloured one for files.
+// It goes by the flags as parsed into fs.
+func (o *formatOptions) build(fs *flag.FlagSet) (stdout, file formatter, err error) {
+	name := o.name
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "format"
+	})
+	for _, alias := range []struct {
+		set  bool
+		name string
+	}{{o.compact, "compact"}, {o.asJSON, "json"}} {
+		if !alias.set {
+			continue
+		}
+		if explicit && name != alias.name {
+			return nil, nil, fmt.Errorf("--%s conflicts with --format %s", alias.name, name)
+		}
+		name = alias.name
+	}
+
+	build, ok := formatters[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown --format %q (want one of %s)", name, strings.Join(formatterNames(), ", "))
+	}
+	return build(!o.noColor && stdoutHasColor()), build(false), nil
+}
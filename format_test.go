@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// testEvent is a group message whose content needs quoting in CSV.
+func testEvent(t *testing.T) whatsappclient.Event {
+	// The text formats print local times
+	orig := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = orig })
+
+	return whatsappclient.Event{
+		ID:         "3EB0ABC",
+		Chat:       types.NewJID("120363025246125486", types.GroupServer),
+		Sender:     types.NewJID("15551234567", types.DefaultUserServer),
+		SenderName: "Ann",
+		IsGroup:    true,
+		Timestamp:  time.Date(2024, 3, 1, 9, 30, 5, 0, time.UTC),
+		Type:       whatsappclient.TypeText,
+		Content:    "hello, \"world\"\nsecond line",
+	}
+}
+
+func TestTextFormatter(t *testing.T) {
+	got := textFormatter{}.Format(testEvent(t))
+	want := "\n=== New Message ===\n" +
+		"From: Ann\n" +
+		"Type: Group Message\n" +
+		"Group: 120363025246125486@g.us\n" +
+		"Time: 2024-03-01 09:30:05\n" +
+		"Content: hello, \"world\"\nsecond line\n" +
+		"=================\n"
+	if got != want {
+		t.Errorf("text output:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestCompactFormatter(t *testing.T) {
+	msg := testEvent(t)
+	got := compactFormatter{}.Format(msg)
+	want := "09:30:05 [120363025246125486@g.us] Ann: hello, \"world\" second line\n"
+	if got != want {
+		t.Errorf("compact output = %q, want %q", got, want)
+	}
+
+	msg.Content = strings.Repeat("x", compactWidth+10)
+	line := compactFormatter{}.Format(msg)
+	if content := line[strings.LastIndex(line, ": ")+2 : len(line)-1]; len([]rune(content)) != compactWidth || !strings.HasSuffix(content, "…") {
+		t.Errorf("long content not cut to %d characters with an ellipsis: %q", compactWidth, content)
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	got := jsonFormatter{}.Format(testEvent(t))
+	if !strings.HasSuffix(got, "\n") || strings.Count(got, "\n") != 1 {
+		t.Fatalf("JSON output is not a single line: %q", got)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &fields); err != nil {
+		t.Fatalf("JSON output doesn't parse: %v", err)
+	}
+	want := map[string]interface{}{
+		"id":          "3EB0ABC",
+		"chat":        "120363025246125486@g.us",
+		"sender":      "15551234567@s.whatsapp.net",
+		"sender_name": "Ann",
+		"is_from_me":  false,
+		"is_group":    true,
+		"timestamp":   "2024-03-01T09:30:05Z",
+		"type":        "text",
+		"content":     "hello, \"world\"\nsecond line",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("JSON field %q = %v, want %v", key, fields[key], value)
+		}
+	}
+	if len(fields) != len(want) {
+		t.Errorf("JSON has fields %v, want exactly %d", fields, len(want))
+	}
+}
+
+func TestCSVFormatter(t *testing.T) {
+	f := csvFormatter{}
+	if got, want := f.Header(), "timestamp,chat,id,sender,sender_name,is_from_me,is_group,type,content\n"; got != want {
+		t.Errorf("CSV header = %q, want %q", got, want)
+	}
+
+	got := f.Format(testEvent(t))
+	want := "2024-03-01T09:30:05Z,120363025246125486@g.us,3EB0ABC,15551234567@s.whatsapp.net,Ann,false,true,text,\"hello, \"\"world\"\"\nsecond line\"\n"
+	if got != want {
+		t.Errorf("CSV row = %q, want %q", got, want)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(f.Header() + got)).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV output doesn't parse: %v", err)
+	}
+	if len(records) != 2 || records[1][len(csvColumns)-1] != testEvent(t).Content {
+		t.Errorf("CSV round trip = %q", records)
+	}
+}
+
+// nameContacts is a contact store that only knows names.
+type nameContacts struct {
+	store.ContactStore
+	names map[types.JID]string
+}
+
+func (c nameContacts) GetContact(user types.JID) (types.ContactInfo, error) {
+	name, ok := c.names[user]
+	return types.ContactInfo{Found: ok, FullName: name}, nil
+}
+
+func TestJIDFormat(t *testing.T) {
+	defer func(format string, contacts store.ContactStore) {
+		jidFormat, jidContacts = format, contacts
+	}(jidFormat, jidContacts)
+	jidContacts = nameContacts{names: map[types.JID]string{
+		types.NewJID("15557654321", types.DefaultUserServer): "Bob",
+	}}
+
+	tests := []struct {
+		format      string
+		wantGroup   string
+		wantNoPush  string
+		wantUnknown string
+	}{
+		{format: jidFormatFull, wantGroup: "120363025246125486@g.us",
+			wantNoPush: "15557654321@s.whatsapp.net", wantUnknown: "15559999999@s.whatsapp.net"},
+		{format: jidFormatUser, wantGroup: "120363025246125486",
+			wantNoPush: "15557654321", wantUnknown: "15559999999"},
+		{format: jidFormatPretty, wantGroup: "120363025246125486",
+			wantNoPush: "Bob", wantUnknown: "15559999999"},
+	}
+	for _, tt := range tests {
+		jidFormat = tt.format
+		msg := testEvent(t)
+
+		text := textFormatter{}.Format(msg)
+		if want := "From: Ann\n"; !strings.Contains(text, want) {
+			t.Errorf("%s: text output %q lacks %q", tt.format, text, want)
+		}
+		if want := "Group: " + tt.wantGroup + "\n"; !strings.Contains(text, want) {
+			t.Errorf("%s: text output %q lacks %q", tt.format, text, want)
+		}
+
+		// Senders without a push name fall back to their JID
+		msg.SenderName = ""
+		msg.Sender = types.NewJID("15557654321", types.DefaultUserServer)
+		compact := compactFormatter{}.Format(msg)
+		if want := "[" + tt.wantGroup + "] " + tt.wantNoPush + ": "; !strings.Contains(compact, want) {
+			t.Errorf("%s: compact output %q lacks %q", tt.format, compact, want)
+		}
+		msg.Sender = types.NewJID("15559999999", types.DefaultUserServer)
+		if got := senderLabel(msg); got != tt.wantUnknown {
+			t.Errorf("%s: sender without a name or contact = %q, want %q", tt.format, got, tt.wantUnknown)
+		}
+
+		// JSON always has the full JID and the push name as it was
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(jsonFormatter{}.Format(msg)), &fields); err != nil {
+			t.Fatalf("%s: JSON output doesn't parse: %v", tt.format, err)
+		}
+		if fields["sender"] != "15559999999@s.whatsapp.net" || fields["sender_name"] != "" {
+			t.Errorf("%s: JSON sender = %v, name %q", tt.format, fields["sender"], fields["sender_name"])
+		}
+	}
+}
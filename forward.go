@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// buildForward copies a stored message for forwarding: the same content
+// and, for media, the same upload, marked as forwarded one more time than
+// the original. Quotes and mentions belong to the original chat and are
+// dropped.
+func buildForward(orig *waE2E.Message) (*waE2E.Message, error) {
+	msg := proto.Clone(orig).(*waE2E.Message)
+	// Secrets and device metadata go with the original message, not the copy
+	msg.MessageContextInfo = nil
+
+	if msg.Conversation != nil {
+		// Conversation has no ContextInfo to carry the forwarded flag
+		msg.ExtendedTextMessage = &waE2E.ExtendedTextMessage{Text: msg.Conversation}
+		msg.Conversation = nil
+	}
+	ctxInfo := contextInfoOf(msg)
+	if ctxInfo == nil {
+		msgType, _ := whatsappclient.ExtractContent(orig)
+		return nil, fmt.Errorf("%s messages can't be forwarded", msgType)
+	}
+
+	*ctxInfo = &waE2E.ContextInfo{
+		IsForwarded: proto.Bool(true),
+		// WhatsApp labels a message "forwarded many times" from a score of 5
+		ForwardingScore: proto.Uint32((*ctxInfo).GetForwardingScore() + 1),
+	}
+	return msg, nil
+}
+
+// reuploadMedia downloads the media of a forward and uploads it again, so
+// the copy gets its own upload instead of pointing at the original's. A
+// message without media is left alone.
+func reuploadMedia(ctx context.Context, m messenger, msg *waE2E.Message) error {
+	media, _, _, err := downloadableFrom(msg)
+	if err != nil {
+		return nil
+	}
+	data, err := m.Download(media)
+	if isMediaExpired(err) {
+		return fmt.Errorf("the media has expired and is no longer available on WhatsApp's servers")
+	} else if err != nil {
+		return fmt.Errorf("failed to download media: %v", err)
+	}
+
+	mediaType := whatsmeow.MediaImage
+	switch {
+	case msg.VideoMessage != nil:
+		mediaType = whatsmeow.MediaVideo
+	case msg.AudioMessage != nil:
+		mediaType = whatsmeow.MediaAudio
+	case msg.DocumentMessage != nil:
+		mediaType = whatsmeow.MediaDocument
+	}
+	uploaded, err := uploadMedia(ctx, m, data, mediaType)
+	if err != nil {
+		return fmt.Errorf("failed to upload media: %v", err)
+	}
+
+	url, directPath := proto.String(uploaded.URL), proto.String(uploaded.DirectPath)
+	length := proto.Uint64(uploaded.FileLength)
+	switch {
+	case msg.ImageMessage != nil:
+		img := msg.ImageMessage
+		img.URL, img.DirectPath, img.FileLength = url, directPath, length
+		img.MediaKey, img.FileEncSHA256, img.FileSHA256 = uploaded.MediaKey, uploaded.FileEncSHA256, uploaded.FileSHA256
+	case msg.VideoMessage != nil:
+		video := msg.VideoMessage
+		video.URL, video.DirectPath, video.FileLength = url, directPath, length
+		video.MediaKey, video.FileEncSHA256, video.FileSHA256 = uploaded.MediaKey, uploaded.FileEncSHA256, uploaded.FileSHA256
+	case msg.AudioMessage != nil:
+		audio := msg.AudioMessage
+		audio.URL, audio.DirectPath, audio.FileLength = url, directPath, length
+		audio.MediaKey, audio.FileEncSHA256, audio.FileSHA256 = uploaded.MediaKey, uploaded.FileEncSHA256, uploaded.FileSHA256
+	case msg.DocumentMessage != nil:
+		doc := msg.DocumentMessage
+		doc.URL, doc.DirectPath, doc.FileLength = url, directPath, length
+		doc.MediaKey, doc.FileEncSHA256, doc.FileSHA256 = uploaded.MediaKey, uploaded.FileEncSHA256, uploaded.FileSHA256
+	case msg.StickerMessage != nil:
+		sticker := msg.StickerMessage
+		sticker.URL, sticker.DirectPath, sticker.FileLength = url, directPath, length
+		sticker.MediaKey, sticker.FileEncSHA256, sticker.FileSHA256 = uploaded.MediaKey, uploaded.FileEncSHA256, uploaded.FileSHA256
+	}
+	return nil
+}
+
+func forwardMessage(ctx context.Context, args []string) error {
+	fs := newFlagSet("forward")
+	reupload := fs.Bool("reupload", false, "upload the media again instead of pointing at the original upload")
+	var ephemeral ephemeralOptions
+	ephemeral.register(fs)
+	storePath := bindSetting(fs, messagesDBSetting)
+	retries := bindSetting(fs, uploadRetriesSetting)
+	args = parseCommandFlags(fs, args, storePath, retries)
+
+	if len(args) != 3 {
+		fmt.Println("Usage: forward <source-chat> <message-id> <recipient> [--reupload]")
+		return errUsage
+	}
+	if err := whatsappclient.ValidateRecipient(args[2]); err != nil {
+		return err
+	}
+	if err := ephemeral.validate(); err != nil {
+		return err
+	}
+	if err := applyUploadRetries(); err != nil {
+		return err
+	}
+
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to set up client: %v", err)
+	}
+
+	chat, err := client.ResolveRecipient(args[0])
+	if err != nil {
+		return err
+	}
+
+	store, err := openMessageStore(messageStorePath(client.DBPath))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	stored, err := store.Get(chat, args[1])
+	if errors.Is(err, errMessageNotFound) {
+		return fmt.Errorf("message %s in %s is not in the local store. Run 'go run . message --store-messages' to record messages as they arrive", args[1], chat.String())
+	} else if err != nil {
+		return err
+	}
+
+	msg, err := buildForward(stored.Message)
+	if err != nil {
+		return err
+	}
+	// Refuse before connecting, and before --reupload uploads anything
+	if err := ephemeral.check(msg); err != nil {
+		return err
+	}
+
+	if err := connectAndWait(client); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if *reupload {
+		if err := reuploadMedia(ctx, client, msg); err != nil {
+			return err
+		}
+	}
+	if err := ephemeral.apply(client, args[2], msg); err != nil {
+		return err
+	}
+
+	return sendAndReport(ctx, client, args[2], msg, "forwarded message")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// reconnectMarkers prints a marker line when the listener reconnects and
+// another once the messages queued on the server while it was away have
+// been delivered, so a reconnect is never silent. The markers name the
+// window messages could have been missed in: from the newest message seen
+// before the connection dropped until it came back.
+type reconnectMarkers struct {
+	lock  sync.Mutex
+	color bool
+
+	connected bool
+	// disconnectedAt is when the connection dropped, if whatsmeow said so;
+	// the watchdog's own reconnects don't emit Disconnected
+	disconnectedAt time.Time
+	// lastSeen is the send time of the newest message received, starting
+	// at when the listener did since nothing before it is followed
+	lastSeen time.Time
+
+	catchingUp       bool
+	gapStart, gapEnd time.Time
+	caughtUp         int
+}
+
+// newReconnectMarkers returns the markers for messages printed with
+// stdout, or nil for JSON and CSV, where a line that isn't a record would
+// break whatever parses them.
+func newReconnectMarkers(stdout formatter) *reconnectMarkers {
+	m := &reconnectMarkers{lastSeen: time.Now()}
+	switch f := stdout.(type) {
+	case textFormatter:
+		m.color = f.color
+	case compactFormatter:
+		m.color = f.color
+	default:
+		return nil
+	}
+	return m
+}
+
+// handleEvent is registered as a client event handler.
+func (m *reconnectMarkers) handleEvent(evt interface{}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	switch v := evt.(type) {
+	case *events.Message:
+		if v.Info.Timestamp.After(m.lastSeen) {
+			m.lastSeen = v.Info.Timestamp
+		}
+		if m.catchingUp {
+			m.caughtUp++
+		}
+	case *events.Disconnected:
+		if m.disconnectedAt.IsZero() {
+			m.disconnectedAt = time.Now()
+			m.print("disconnected, reconnecting; last message seen was sent at %s", m.lastSeen.Local().Format("2006-01-02 15:04:05"))
+		}
+	case *events.Connected:
+		// The first connection's offline backlog isn't a gap in anything
+		// the listener followed
+		if !m.connected {
+			m.connected = true
+			return
+		}
+		m.catchingUp, m.caughtUp = true, 0
+		m.gapStart, m.gapEnd = m.lastSeen, time.Now()
+		offline := ""
+		if !m.disconnectedAt.IsZero() {
+			offline = fmt.Sprintf(" after %s offline", m.gapEnd.Sub(m.disconnectedAt).Round(time.Second))
+			m.disconnectedAt = time.Time{}
+		}
+		m.print("reconnected%s, catching up on messages sent since %s", offline, m.gapStart.Local().Format("2006-01-02 15:04:05"))
+	case *events.OfflineSyncCompleted:
+		if !m.catchingUp {
+			return
+		}
+		m.catchingUp = false
+		m.print("caught up: %d %s from %s to %s", m.caughtUp, plural(m.caughtUp, "message", "messages"),
+			m.gapStart.Local().Format("2006-01-02 15:04:05"), m.gapEnd.Local().Format("15:04:05"))
+	}
+}
+
+func (m *reconnectMarkers) print(format string, args ...interface{}) {
+	line := "--- " + fmt.Sprintf(format, args...) + " ---"
+	if m.color {
+		line = paint(ansiDim, line)
+	}
+	fmt.Println(line)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// printGroupEvent prints notifications for group membership and metadata
+// changes: being added to a group, and subject/topic/member updates.
+func printGroupEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.JoinedGroup:
+		fmt.Printf("[Group] Added to group %s (%s)\n", v.Name, formatJID(v.JID))
+	case *events.GroupInfo:
+		if v.Name != nil {
+			fmt.Printf("[Group] Group %s subject changed to %q\n", formatJID(v.JID), v.Name.Name)
+		}
+		if v.Topic != nil {
+			fmt.Printf("[Group] Group %s description changed to %q\n", formatJID(v.JID), v.Topic.Topic)
+		}
+		printGroupMembers(v.JID, "joined", v.Join)
+		printGroupMembers(v.JID, "left", v.Leave)
+		printGroupMembers(v.JID, "promoted to admin", v.Promote)
+		printGroupMembers(v.JID, "demoted from admin", v.Demote)
+		if v.Delete != nil {
+			fmt.Printf("[Group] Group %s was deleted\n", formatJID(v.JID))
+		}
+	}
+}
+
+func printGroupMembers(group types.JID, action string, members []types.JID) {
+	for _, member := range members {
+		fmt.Printf("[Group] %s %s group %s\n", formatJID(member), action, formatJID(group))
+	}
+}
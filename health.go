@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// serveHealth starts the liveness and readiness endpoints on addr:
+// /healthz answers as long as the process does, and /readyz only while
+// client is connected and logged in, so an orchestrator can restart a
+// listener whose connection has died. Like serve for metrics, the listener
+// is bound before returning.
+func serveHealth(addr string, client *whatsappclient.Client) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case !client.IsConnected():
+			http.Error(w, "not connected", http.StatusServiceUnavailable)
+		case !client.IsLoggedIn():
+			http.Error(w, "not logged in", http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, "ok")
+		}
+	})
+	srv := &http.Server{Handler: mux}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Health server error: %v\n", err)
+		}
+	}()
+
+	return srv, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// JID formats for --jid-format.
+const (
+	jidFormatFull   = "full"
+	jidFormatUser   = "user"
+	jidFormatPretty = "pretty"
+)
+
+// jidFormat is how the listener's human-readable output prints JIDs:
+// jidFormatFull (user@server), jidFormatUser (the number or group ID) or
+// jidFormatPretty (the contact's name when known, the number otherwise).
+// JSON and CSV output always have full JIDs, for whatever parses them.
+var jidFormat = jidFormatFull
+
+// jidContacts looks up names for jidFormatPretty; applyJIDFormat sets it.
+var jidContacts store.ContactStore
+
+func registerJIDFormat(fs *flag.FlagSet) {
+	fs.StringVar(&jidFormat, "jid-format", jidFormatFull, "print JIDs as full (user@server), user (just the number) or pretty (the contact's name when known)")
+}
+
+// validateJIDFormat checks --jid-format before connecting.
+func validateJIDFormat() error {
+	switch jidFormat {
+	case jidFormatFull, jidFormatUser, jidFormatPretty:
+		return nil
+	}
+	return fmt.Errorf("invalid --jid-format %q (want %s, %s or %s)", jidFormat, jidFormatFull, jidFormatUser, jidFormatPretty)
+}
+
+// applyJIDFormat gives jidFormatPretty the contacts of the session.
+func applyJIDFormat(contacts store.ContactStore) {
+	jidContacts = contacts
+}
+
+// formatJID renders jid in jidFormat. Groups aren't in the contact store,
+// so pretty falls back to the group ID for them.
+func formatJID(jid types.JID) string {
+	switch jidFormat {
+	case jidFormatUser:
+		return jid.User
+	case jidFormatPretty:
+		if jidContacts != nil {
+			if contact, err := jidContacts.GetContact(jid.ToNonAD()); err == nil && contact.Found {
+				if name := displayName(contact); name != "" {
+					return name
+				}
+			}
+		}
+		return jid.User
+	}
+	return jid.String()
+}
+
+// formatSource is MessageSource.SourceString in jidFormat: the sender, and
+// the chat when that is a group.
+func formatSource(source types.MessageSource) string {
+	if source.Sender != source.Chat {
+		return formatJID(source.Sender) + " in " + formatJID(source.Chat)
+	}
+	return formatJID(source.Chat)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// latencyTracker logs how long each message took from the sender to the
+// listener, and sums it up on shutdown. Message timestamps come from the
+// sender's side in whole seconds, so the figures are at best accurate to a
+// second, and are corrected for the local clock's skew once it is known.
+type latencyTracker struct {
+	lock sync.Mutex
+	// skew is how far the local clock is ahead of WhatsApp's
+	skew time.Duration
+	// connectedAt is when the current connection came up. Messages sent
+	// before it are backlog that waited on the server while we were
+	// offline, which says nothing about the connection
+	connectedAt time.Time
+
+	count         int
+	backlog       int
+	min, max, sum time.Duration
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{}
+}
+
+// measureSkew checks the local clock against WhatsApp's. Until it returns,
+// and if it fails, latencies assume the clocks agree.
+func (l *latencyTracker) measureSkew(ctx context.Context, client *whatsappclient.Client) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	skew, err := client.ClockSkew(ctx)
+	if err != nil {
+		fmt.Printf("[Latency] Couldn't check the clock, assuming it is right: %v\n", err)
+		return
+	}
+	l.lock.Lock()
+	l.skew = skew
+	l.lock.Unlock()
+	if skew.Abs() >= time.Second {
+		fmt.Printf("[Latency] Correcting for a local clock skew of %s\n", skew.Round(time.Second))
+	}
+}
+
+// handleEvent is registered as a client event handler.
+func (l *latencyTracker) handleEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Connected:
+		l.lock.Lock()
+		l.connectedAt = time.Now()
+		l.lock.Unlock()
+	case *events.Message:
+		l.observe(v, time.Now())
+	}
+}
+
+func (l *latencyTracker) observe(v *events.Message, received time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// Bring the receive time onto WhatsApp's clock, which the sender's
+	// timestamp is on too
+	received = received.Add(-l.skew)
+	if v.Info.Timestamp.Before(l.connectedAt.Add(-l.skew)) {
+		l.backlog++
+		return
+	}
+	// What's left of the skew correction's error can make a fast delivery
+	// come out negative
+	latency := max(received.Sub(v.Info.Timestamp), 0)
+
+	if l.count == 0 || latency < l.min {
+		l.min = latency
+	}
+	l.max = max(l.max, latency)
+	l.sum += latency
+	l.count++
+	fmt.Printf("[Latency] %s for message %s from %s\n", formatLatency(latency), v.Info.ID, formatJID(v.Info.Sender.ToNonAD()))
+}
+
+// summary prints the aggregate over the run.
+func (l *latencyTracker) summary() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.count == 0 {
+		fmt.Println("[Latency] No live messages received")
+	} else {
+		avg := l.sum / time.Duration(l.count)
+		fmt.Printf("[Latency] %d messages: min %s, avg %s, max %s\n", l.count, formatLatency(l.min), formatLatency(avg), formatLatency(l.max))
+	}
+	if l.backlog > 0 {
+		fmt.Printf("[Latency] %d offline messages sent before connecting were left out\n", l.backlog)
+	}
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// maxLiveLocationDuration is the longest share the phone app offers.
+const maxLiveLocationDuration = 8 * time.Hour
+
+type livePoint struct {
+	lat, lng float64
+}
+
+// parseLivePoint reads a "lat,lng" or "lat lng" line of coordinates.
+func parseLivePoint(line string) (livePoint, error) {
+	fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(fields) != 2 {
+		return livePoint{}, fmt.Errorf("want \"lat,lng\", got %q", line)
+	}
+	lat, lng, err := parseLocation(fields[0], fields[1])
+	return livePoint{lat, lng}, err
+}
+
+// readLivePoints sends the coordinates read from r, one per line, on
+// points until r ends. Blank lines and # comments are skipped, and
+// malformed lines are reported but don't stop the share.
+func readLivePoints(r io.Reader, points chan<- livePoint) {
+	defer close(points)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseLivePoint(line)
+		if err != nil {
+			fmt.Printf("Skipping line: %v\n", err)
+			continue
+		}
+		points <- p
+	}
+}
+
+// gpxFile is the part of a GPX file with coordinates: track points, or
+// route points and waypoints for files without a track.
+type gpxFile struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Routes []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Waypoints []gpxPoint `xml:"wpt"`
+}
+
+type gpxPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+// loadGPX returns the points of a GPX file in order.
+func loadGPX(path string) ([]livePoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GPX file: %v", err)
+	}
+	var gpx gpxFile
+	if err := xml.Unmarshal(data, &gpx); err != nil {
+		return nil, fmt.Errorf("invalid GPX file: %v", err)
+	}
+
+	var raw []gpxPoint
+	for _, trk := range gpx.Tracks {
+		for _, seg := range trk.Segments {
+			raw = append(raw, seg.Points...)
+		}
+	}
+	if len(raw) == 0 {
+		for _, rte := range gpx.Routes {
+			raw = append(raw, rte.Points...)
+		}
+	}
+	if len(raw) == 0 {
+		raw = gpx.Waypoints
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("%s has no track, route or waypoints", path)
+	}
+
+	points := make([]livePoint, len(raw))
+	for i, p := range raw {
+		if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+			return nil, fmt.Errorf("point %d of %s is out of range: %v,%v", i+1, path, p.Lat, p.Lon)
+		}
+		points[i] = livePoint{p.Lat, p.Lon}
+	}
+	return points, nil
+}
+
+// liveLocationShare numbers the messages of one share. The first message
+// starts it; each update is another LiveLocationMessage with the next
+// sequence number and the seconds since the start, which is how recipients
+// tie it to the share rather than showing a new one.
+type liveLocationShare struct {
+	caption  string
+	started  time.Time
+	sequence int64
+}
+
+func (s *liveLocationShare) next(p livePoint, now time.Time) *waE2E.Message {
+	if s.sequence == 0 {
+		s.started = now
+	}
+	s.sequence++
+	live := &waE2E.LiveLocationMessage{
+		DegreesLatitude:  proto.Float64(p.lat),
+		DegreesLongitude: proto.Float64(p.lng),
+		SequenceNumber:   proto.Int64(s.sequence),
+		TimeOffset:       proto.Uint32(uint32(now.Sub(s.started).Seconds())),
+	}
+	if s.caption != "" {
+		live.Caption = proto.String(s.caption)
+	}
+	return &waE2E.Message{LiveLocationMessage: live}
+}
+
+// takePoint returns the next point that is ready without waiting. With
+// latest set it skips to the newest one, so a fast GPS feed on stdin is
+// thinned out to --interval instead of falling behind; GPX points are sent
+// one per interval. ended is set once points is closed and empty.
+func takePoint(points <-chan livePoint, latest bool) (p livePoint, ok, ended bool) {
+	for {
+		select {
+		case next, open := <-points:
+			if !open {
+				return p, ok, !ok
+			}
+			p, ok = next, true
+			if !latest {
+				return p, true, false
+			}
+		default:
+			return p, ok, false
+		}
+	}
+}
+
+func sendLiveLocation(ctx context.Context, args []string) error {
+	fs := newFlagSet("send-live-location")
+	gpxPath := fs.String("gpx", "", "replay the points of this GPX track, one per --interval (default: read \"lat,lng\" lines from stdin)")
+	interval := fs.Duration("interval", 30*time.Second, "how often to send an update")
+	caption := fs.String("caption", "", "comment shown with the live location")
+	args = parseCommandFlags(fs, args)
+
+	if len(args) != 2 {
+		fmt.Println("Usage: send-live-location <recipient> <duration> [--gpx <file>] [--interval 30s] [--caption <text>]")
+		return errUsage
+	}
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(args[1])
+	if err != nil || duration <= 0 || duration > maxLiveLocationDuration {
+		return fmt.Errorf("invalid duration %q: want a positive duration up to %s, e.g. 15m or 1h", args[1], maxLiveLocationDuration)
+	}
+	if *interval < 5*time.Second {
+		return fmt.Errorf("--interval must be at least 5s")
+	}
+
+	// Buffered so takePoint can find every line that arrived since the
+	// last update, not just the one the reader is blocked on
+	points := make(chan livePoint, 64)
+	if *gpxPath != "" {
+		track, err := loadGPX(*gpxPath)
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer close(points)
+			for _, p := range track {
+				points <- p
+			}
+		}()
+	} else {
+		go readLivePoints(os.Stdin, points)
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+	to, err := client.ResolveRecipient(args[0])
+	if err != nil {
+		return err
+	}
+
+	share := &liveLocationShare{caption: *caption}
+	send := func(p livePoint) error {
+		resp, err := client.SendMessage(ctx, to, share.next(p, time.Now()))
+		if err != nil {
+			return withExitCode(exitSendFailure, fmt.Errorf("failed to send live location update %d: %v", share.sequence, err))
+		}
+		fmt.Printf("Live location %d sent to %s: %.6f,%.6f (ID: %s)\n", share.sequence, to.String(), p.lat, p.lng, resp.ID)
+		return nil
+	}
+
+	if *gpxPath == "" {
+		fmt.Println("Reading \"lat,lng\" lines from stdin...")
+	}
+	var first livePoint
+	select {
+	case p, ok := <-points:
+		if !ok {
+			return fmt.Errorf("no coordinates given")
+		}
+		first = p
+	case <-ctx.Done():
+		return nil
+	}
+	if err := send(first); err != nil {
+		return err
+	}
+
+	end := time.NewTimer(duration)
+	defer end.Stop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p, ok, ended := takePoint(points, *gpxPath == "")
+			if ended {
+				fmt.Printf("Input ended after %d updates\n", share.sequence)
+				return nil
+			}
+			if !ok {
+				continue
+			}
+			if err := send(p); err != nil {
+				return err
+			}
+		case <-end.C:
+			fmt.Printf("Shared live location with %s for %s (%d updates)\n", to.String(), duration, share.sequence)
+			return nil
+		case <-ctx.Done():
+			fmt.Println("\nStopped sharing live location")
+			return nil
+		}
+	}
+}
@@ -2,302 +2,650 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
-	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/skip2/go-qrcode"
-	"go.mau.fi/whatsmeow"
-	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
-	_ "modernc.org/sqlite"
+
+	"whatsapp-qr/whatsappclient"
 )
 
 func main() {
 	if len(os.Args) < 2 {
 		printHelp()
+		printFirstRunHint()
 		return
 	}
 
-	command := os.Args[1]
-	switch command {
-	case "message":
-		listenForMessages()
-	case "qr":
-		generateQR()
-	case "help":
-		printHelp()
-	default:
-		fmt.Printf("Unknown command: %s\n", command)
+	// Ctrl+C or SIGTERM cancels ctx so in-flight sends, uploads and waits
+	// return promptly. Once it fires the default handling is restored, so a
+	// second Ctrl+C exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	ctx = withDeadline(ctx)
+
+	var err error
+	if cmd, ok := findCommand(os.Args[1]); ok {
+		running = cmd
+		err = cmd.run(ctx, os.Args[2:])
+	} else {
+		fmt.Printf("Unknown command: %s\n", os.Args[1])
 		printHelp()
+		err = errUsage
+	}
+
+	if client := openedClient.Load(); client != nil {
+		client.Close()
+	}
+
+	err = deadlineError(err)
+	if err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Printf("Error: %v\n", err)
+		}
+		stop()
+		os.Exit(exitCodeFor(err))
 	}
 }
 
 func printHelp() {
 	fmt.Println("WhatsApp CLI Application")
 	fmt.Println("\nUsage:")
-	fmt.Println("  go run main.go <command>")
+	fmt.Println("  go run . <command> [options]")
 	fmt.Println("\nCommands:")
-	fmt.Println("  message    Listen for incoming WhatsApp messages")
-	fmt.Println("  qr        Generate QR code for new WhatsApp login")
-	fmt.Println("  help      Show this help message")
+	fmt.Println("  message    Listen for incoming WhatsApp messages (alias: msg, listen)")
+	fmt.Println("  watch     Listen like message, printing one line per message (--from, --chat, --filter-type)")
+	fmt.Println("  pull      Connect, print the messages received while offline, and exit")
+	fmt.Println("  qr        Generate QR code for new WhatsApp login, added beside any stored (alias: login)")
+	fmt.Println("  send <recipient>[,<recipient>...] <text|->")
+	fmt.Println("            Send a text message to one or more recipients (--mention <member> in groups)")
+	fmt.Println("  bulk-send <csv-file> <template>")
+	fmt.Println("            Send a templated message to every row of a CSV file")
+	fmt.Println("  retry-failed <results-file>")
+	fmt.Println("            Resend the failed and skipped rows of a bulk-send results file, updating it in place")
+	fmt.Println("  broadcast <list-name> <text|->")
+	fmt.Println("            Send a text privately to every member of a broadcast list (--rate, --retries, --dry-run)")
+	fmt.Println("  broadcast-list [show [name]] | create|delete <name> | add|remove <name> <member>...")
+	fmt.Println("            Manage broadcast lists, kept in the session database")
+	fmt.Println("  send-buttons <recipient> <body> <button> [button] [button]")
+	fmt.Println("            Send a message with up to three reply buttons (--footer <text>)")
+	fmt.Println("  send-contact <recipient> <name> <phone> [<name> <phone>...]")
+	fmt.Println("            Share one or more contact cards (vCards)")
+	fmt.Println("  send-poll <recipient> <question> <option> <option> [option...]")
+	fmt.Println("            Send a poll with 2 to 12 options (--multi to allow several choices)")
+	fmt.Println("  send-location <recipient> <lat> <lng> [name] [address]")
+	fmt.Println("            Send a location pin")
+	fmt.Println("  send-live-location <recipient> <duration> [--gpx <file>]")
+	fmt.Println("            Share a live location, updated from \"lat,lng\" lines on stdin or a GPX track")
+	fmt.Println("  schedule <recipient> <time> <text|->")
+	fmt.Println("            Queue a text message for a listener running with --send-scheduled (--list, --cancel <n>)")
+	fmt.Println("  forward <source-chat> <message-id> <recipient> [--reupload]")
+	fmt.Println("            Forward a message recorded with --store-messages to another chat")
+	fmt.Println("  send-image|send-video|send-document|send-voice <recipient> <path>")
+	fmt.Println("            Upload and send a media file; send-voice takes Ogg Opus and sends a voice note")
+	fmt.Println("            send-document --thumbnail <image> shows a preview instead of the file icon")
+	fmt.Println("  send-album <recipient> <path> <path> [path...]")
+	fmt.Println("            Send 2 to 30 images and videos grouped as one album (--caption for the first)")
+	fmt.Println("  block <jid> | unblock <jid>")
+	fmt.Println("            Block or unblock a contact")
+	fmt.Println("  blocklist Show blocked contacts")
+	fmt.Println("  privacy [set <setting> <value>]")
+	fmt.Println("            Show or change who sees your last seen, photo, about, etc.")
+	fmt.Println("  archive <chat> | unarchive <chat>")
+	fmt.Println("  pin <chat> | unpin <chat>")
+	fmt.Println("  mute <chat> <duration|forever> | unmute <chat>")
+	fmt.Println("            Archive, pin or mute a chat (synced to your phone)")
+	fmt.Println("  export-session <file> | import-session <file>")
+	fmt.Println("            Move a logged-in session to another machine in a passphrase-encrypted file")
+	fmt.Println("  restore-backup <file>")
+	fmt.Println("            Replace the session database with a backup taken before a risky change")
+	fmt.Println("  resync-appstate")
+	fmt.Println("            Fetch contacts and chat settings again from a full app-state snapshot")
+	fmt.Println("  check <phone>...")
+	fmt.Println("            Check whether phone numbers are on WhatsApp")
+	fmt.Println("  contact <phone|jid|me> [--json]")
+	fmt.Println("            Show a contact's names, about text and profile picture")
+	fmt.Println("  status-text <phone|jid|me>...")
+	fmt.Println("            Show the about text of one or more users and when it was set")
+	fmt.Println("  contacts  List contacts from the local store")
+	fmt.Println("  groups    List joined groups")
+	fmt.Println("  devices [remove <device>]")
+	fmt.Println("            List the devices linked to the account (--json), or unlink one by JID or number")
+	fmt.Println("  set-name <name>")
+	fmt.Println("            Set the push name other users see")
+	fmt.Println("  download <chat> <message-id> [--out <path>]")
+	fmt.Println("            Download the media of a message recorded with --store-messages")
+	fmt.Println("  stats [chat] [--since <date>] [--until <date>] [--json]")
+	fmt.Println("            Count messages recorded with --store-messages by type, sender, day and chat")
+	fmt.Println("  search <query> [--chat <chat>] [--limit <n>]")
+	fmt.Println("            Find messages recorded with --store-messages containing the text, newest first")
+	fmt.Println("  repl      Connect once and type commands (send, contacts, groups) at a prompt")
+	fmt.Println("  version   Show the app, Go, whatsmeow and WhatsApp Web versions")
+	fmt.Println("  help [command]")
+	fmt.Println("            Show this help message, or a command's options and an example (same as <command> --help)")
+	fmt.Println("\nRecipients are a phone number in international format, a full JID,")
+	fmt.Println("or \"me\"/\"self\" for your own number.")
+	fmt.Println("\nGlobal options (flag, environment variable, config file key):")
+	printSettingsHelp(globalSettings)
+	fmt.Println("  --config           WHATSAPP_CONFIG")
+	fmt.Println("      JSON config file, e.g. {\"db_path\": \"/data/whatsapp.db\"}")
+	fmt.Println("  --no-cache")
+	fmt.Println("      Look up phone numbers with WhatsApp instead of using results cached for 7 days")
+	fmt.Println("  --quiet")
+	fmt.Println("      Log only warnings and errors, and hide the session details printed on startup")
+	fmt.Println("Flags take precedence over environment variables, which take precedence")
+	fmt.Println("over the config file.")
+	fmt.Println("\nMessage options:")
+	fmt.Println("  --appstate                Print contact, chat (pin/mute/archive/delete) and blocklist changes made on other devices")
+	fmt.Println("  --group-events            Print group joins and subject/member changes")
+	fmt.Println("  --calls                   Print incoming call events")
+	fmt.Println("  --reject-calls            Automatically reject incoming calls")
+	fmt.Println("  --security-events         Print contacts' safety number changes")
+	fmt.Println("  --receipts                Print delivered/read receipts, and played for voice and video notes")
+	fmt.Println("  --metrics-addr <addr>     Serve Prometheus metrics on host:port at /metrics")
+	fmt.Println("  --latency                 Log each message's delivery delay, and min/avg/max on exit")
+	fmt.Println("  --store-messages          Record received messages in the local database")
+	fmt.Println("  --messages-db <path>      Keep stored messages in this file instead of the session database")
+	fmt.Println("                            (also read by download, stats and search)")
+	fmt.Println("  --format <name>           Print messages as text (default), compact (default for watch), json or csv")
+	fmt.Println("  --json, --compact         Same as --format json and --format compact")
+	fmt.Println("  --jid-format <f>          Print JIDs as full (user@server, default), user (the number) or pretty (contact names) (pull too)")
+	fmt.Println("  --output <path>           Also append messages to this file (reopened on SIGHUP)")
+	fmt.Println("  --redact                  Mask message content as [REDACTED len=N] in output and webhooks (pull too)")
+	fmt.Println("  --webhook <url>           POST each message as JSON to this URL (env: WHATSAPP_WEBHOOK_URL)")
+	fmt.Println("  --state-webhook <url>     POST connection state changes as JSON to this URL (env: WHATSAPP_STATE_WEBHOOK_URL)")
+	fmt.Println("  --since <time>            Skip messages sent before this RFC3339 time")
+	fmt.Println("  --count <n>               Exit after receiving n messages")
+	fmt.Println("  --ignore-self             Skip messages sent from your own phone or other linked devices")
+	fmt.Println("  --filter-type <types>     Only handle these comma-separated types, e.g. image,video,document")
+	fmt.Println("  --no-color                Don't colour message headers per chat (repl too)")
+	fmt.Println("  --download-dir <dir>      Save received media to this directory")
+	fmt.Println("  --max-download-size <n>   Skip media larger than n bytes, going by the size the message advertises")
+	fmt.Println("  --download-images, --download-videos, --download-audio, --download-docs")
+	fmt.Println("                            Only download these types (default: all)")
+	fmt.Println("  --thumbnails-only         Save the embedded JPEG preview instead of downloading the media")
+	fmt.Println("  --reply-prefix <prefix>   Auto-reply to bot commands, e.g. with ! : !ping, !time")
+	fmt.Println("  --stale-timeout <dur>     Reconnect when nothing is received for this long and a ping fails (e.g. 10m)")
+	fmt.Println("  --send-scheduled          Send messages queued with schedule when due (--missed-schedules send|skip)")
+	fmt.Println("  --on-stream-replaced <p>  When another login of the session takes over: exit (default), reconnect or wait (qr too)")
+	fmt.Println("  --verbose                 Print keepalive timeouts and recoveries, and skipped duplicates")
+	fmt.Println("  --dedup-size <n>          Remember this many message IDs to skip redeliveries (default 1000, 0 = off)")
+	fmt.Println("  --dedup-window <d>        Skip an ID seen again within this long (default 10m)")
+	fmt.Println("  --dedup-persist           Remember the IDs across restarts, in the session database")
+	fmt.Println("\nText options (send):")
+	fmt.Println("  --file <path>             Read the message text from a file (\"-\" as the text reads stdin)")
+	fmt.Println("  --no-trim                 Keep trailing newlines of text from stdin or --file")
+	fmt.Println("\nSend options (send, send-location, send-image/video/document):")
+	fmt.Println("  --ephemeral <timer>       Send as a disappearing message: 24h, 7d, 90d or off")
+	fmt.Println("  --set-chat-timer          Also set the chat's disappearing-messages timer")
+	fmt.Println("\nMedia send options:")
+	fmt.Println("  --caption <text>          Caption shown under the media")
+	fmt.Println("  --reply-to <stanza-id>    Send as a reply to this message (requires --reply-sender)")
+	fmt.Println("  --reply-sender <jid>      Sender of the message being replied to")
+	fmt.Println("  --force                   Send files over WhatsApp's size limit (16 MB images/videos, 100 MB documents)")
+	fmt.Println("  --upload-retries <n>      Retry a failed upload n times with backoff (default 3; send-album and forward too)")
+	fmt.Println("\nBulk send options (--rate, --retries and --dry-run also apply to send, broadcast and retry-failed):")
+	fmt.Println("  --rate <n>                Maximum messages per minute (default 20)")
+	fmt.Println("  --retries <n>             Extra attempts for each failed send (default 2)")
+	fmt.Println("  --strict-template         Fail rows with unfilled {placeholders} instead of leaving them blank")
+	fmt.Println("  --dry-run                 Print the rendered messages without sending")
+	fmt.Println("  --results <path>          Results CSV (default <csv-file>.results.csv)")
+	fmt.Println("The CSV needs a recipient (or phone) column; other columns fill {column}")
+	fmt.Println("placeholders, and {name} falls back to the contact's name.")
+	fmt.Println("If WhatsApp rate-limits a send, all sends pause for 1 minute, doubling up to")
+	fmt.Println("15 minutes while the limit persists.")
+	fmt.Println("\nContacts and groups options:")
+	fmt.Println("  --search <text>           Only list entries whose name or JID contains text")
+	fmt.Println("  --limit <n>               List at most n entries")
+	fmt.Println("  --offset <n>              Skip the first n matching entries")
+	fmt.Println("\nQR options:")
+	fmt.Println("  --login-done-file <path>  Write a JSON file with the JID and time once login completes")
+	fmt.Println("  --max-attempts <n>        Exit with an error after n QR codes expire without a scan")
+	fmt.Println("  --exit-on-login           Exit once login completes instead of waiting for the initial sync")
+	fmt.Println("  --push-name <name>        Set the name recipients see once login completes")
+	fmt.Println("  --device-name <name>      Name shown in the phone's linked-devices list")
+	fmt.Println("  --device-platform <type>  Linked-device icon: chrome, firefox, safari, edge, desktop, ...")
+	fmt.Println("  --qr-mode <mode>          ansi (explicit colours), text (block characters) or auto (default)")
+	fmt.Println("  --qr-invert               Swap dark and light modules")
+	fmt.Println("  --foreground-color <c>    Dark module colour in ansi mode (default black)")
+	fmt.Println("  --background-color <c>    Light module colour in ansi mode (default white)")
+	fmt.Println("  --qr-ec <L|M|Q|H>         Error-correction level (default M)")
+	fmt.Println("  --qr-png <path>           Also save each QR code as a PNG image")
+	fmt.Println("  --qr-size <pixels>        Size of the --qr-png image (default 256)")
+	printExitCodes()
 }
 
-func setupClient() (*whatsmeow.Client, error) {
-	logger := waLog.Stdout("Main", "DEBUG", true)
-	dbLog := waLog.Stdout("Database", "DEBUG", true)
+// printFirstRunHint suggests the next step based on whether a session is
+// stored: logging in with qr, or listening for messages. It only reads the
+// store, and won't create a database that doesn't exist yet.
+func printFirstRunHint() {
+	// Pick up WHATSAPP_DB_PATH and the config file like any other command
+	parseCommandFlags(newFlagSet("help"), nil)
 
-	dir, err := os.Getwd()
+	dbPath, err := whatsappclient.ResolveDBPath(clientOptions.DBPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get working directory: %v", err)
+		return
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		fmt.Printf("\nNo session found at %s. Log in first with:\n  go run . qr\n", dbPath)
+		return
 	}
 
-	dbPath := dir + "/whatsapp.db"
-	fmt.Printf("Database path: %s\n", dbPath)
+	opts := clientOptions
+	opts.LogLevel = "ERROR"
+	opts.PreferredSessionJID = readLastLogin(dbPath)
+	client, err := whatsappclient.New(opts)
+	if err != nil {
+		fmt.Printf("\nCould not read the session database %s: %v\n", dbPath, err)
+		return
+	}
+	defer client.Close()
 
-	dbParams := "?_foreign_keys=on" +
-		"&_pragma=foreign_keys(1)" +
-		"&_pragma=journal_mode(WAL)" + // Use WAL mode for better concurrency
-		"&_pragma=synchronous(NORMAL)" + // Slightly faster, still safe
-		"&_pragma=busy_timeout(5000)" + // Wait up to 5 seconds when database is locked
-		"&_pragma=cache_size(-2000)" // 2MB cache size
+	if !client.Registered {
+		fmt.Printf("\nNo logged-in device in %s. Log in first with:\n  go run . qr\n", dbPath)
+		return
+	}
+	fmt.Printf("\nLogged in as %s. Start listening for messages with:\n  go run . message\n", client.Store.ID.String())
+}
 
-	container, err := sqlstore.New("sqlite", "file:"+dbPath+dbParams, dbLog)
-	if err != nil {
-		if strings.Contains(err.Error(), "foreign keys are not enabled") {
-			fmt.Println("Database appears to be corrupted, removing and creating new one...")
-			os.Remove(dbPath)
-			container, err = sqlstore.New("sqlite", "file:"+dbPath+dbParams, dbLog)
-			if err != nil {
-				return nil, fmt.Errorf("failed to connect to database: %v", err)
-			}
-		} else {
-			return nil, fmt.Errorf("failed to connect to database: %v", err)
+// clientOptions is filled in from command flags before setupClient runs.
+var clientOptions whatsappclient.Options
+
+// openedClient is the client opened by setupClient. It is closed once the
+// command returns, which removes its session lock file, or before a forced
+// exit so its stores are flushed.
+var openedClient atomic.Pointer[whatsappclient.Client]
+
+func setupClient() (*whatsappclient.Client, error) {
+	opts := clientOptions
+	if opts.LogLevel == "" {
+		opts.LogLevel = "DEBUG"
+		if quiet {
+			opts.LogLevel = "WARN"
+		}
+	}
+	if opts.SessionJID == "" {
+		// Prefer the account logged in most recently with qr
+		if dbPath, err := whatsappclient.ResolveDBPath(opts.DBPath); err == nil {
+			opts.PreferredSessionJID = readLastLogin(dbPath)
 		}
 	}
 
-	deviceStore, _ := container.GetFirstDevice()
-	// deviceStore := container.NewDevice()
-	if deviceStore == nil {
-		return nil, fmt.Errorf("failed to create device: device store is nil")
+	client, err := whatsappclient.New(opts)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println("Device store ...", deviceStore.ID)
+	openedClient.Store(client)
 
-	client := whatsmeow.NewClient(deviceStore, logger)
+	// With --quiet these go to the logger at DEBUG, hidden unless asked for
+	report := func(format string, args ...interface{}) {
+		fmt.Printf(format+"\n", args...)
+	}
+	log := waLog.Stdout("Client", opts.LogLevel, true)
+	if quiet {
+		report = log.Debugf
+	}
 
-	if client.Store.ID == nil {
-		fmt.Println("Debug: No device ID found in store")
+	report("Database path: %s", client.DBPath)
+	report("Device store ... %v", client.Store.ID)
+	if client.Proxy != "" {
+		report("Using proxy %s", client.Proxy)
+	}
+	if !client.Registered {
+		report("Debug: No registered device in store, using a new unpaired device")
 	} else {
-		fmt.Printf("Debug: Found device ID: %s\n", client.Store.ID.String())
+		report("Debug: Found device ID: %s", client.Store.ID.String())
 	}
+	go checkClockSkew(client, log)
 
 	return client, nil
 }
 
-func listenForMessages() {
-	client, err := setupClient()
-	if err != nil {
-		fmt.Printf("Error setting up client: %v\n", err)
-		return
+// isLoggedIn reports whether client has a paired device to connect with.
+func isLoggedIn(client *whatsappclient.Client) bool {
+	return client.IsPaired()
+}
+
+// sleepContext pauses for d, returning early with ctx's error if it is
+// cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	// Add message handler
-	client.AddEventHandler(func(evt interface{}) {
-		switch v := evt.(type) {
-		case *events.Message:
-			// Get message content
-			var content string
-			if v.Message.GetConversation() != "" {
-				content = v.Message.GetConversation()
-			} else if v.Message.GetExtendedTextMessage() != nil {
-				content = v.Message.GetExtendedTextMessage().GetText()
-			} else if img := v.Message.GetImageMessage(); img != nil {
-				content = fmt.Sprintf("[Image] Caption: %s", img.GetCaption())
-			} else if video := v.Message.GetVideoMessage(); video != nil {
-				content = fmt.Sprintf("[Video] Caption: %s", video.GetCaption())
-			} else if doc := v.Message.GetDocumentMessage(); doc != nil {
-				content = fmt.Sprintf("[Document] Filename: %s", doc.GetFileName())
-			} else if audio := v.Message.GetAudioMessage(); audio != nil {
-				content = "[Audio]"
-				if audio.GetPTT() {
-					content = "[Voice Message]"
-				}
-			} else if sticker := v.Message.GetStickerMessage(); sticker != nil {
-				content = "[Sticker]"
-			} else if reaction := v.Message.GetReactionMessage(); reaction != nil {
-				content = fmt.Sprintf("[Reaction] %s to message: %s", reaction.GetText(), reaction.GetKey().GetId())
-			} else {
-				content = "[Unknown Message Type]"
-			}
+// errNotLoggedIn is the error for commands that need a session but have none.
+func errNotLoggedIn(client *whatsappclient.Client) error {
+	return withExitCode(exitNotLoggedIn, errors.New(notLoggedInMessage(client)))
+}
 
-			// Get sender info
-			senderInfo := v.Info.PushName
-			if senderInfo == "" {
-				senderInfo = v.Info.Sender.String()
-			}
+// errConnectFailed is the error for a connection that couldn't be set up,
+// naming the proxy so it isn't mistaken for a problem with the session.
+func errConnectFailed(client *whatsappclient.Client, err error) error {
+	if client.Proxy != "" {
+		return withExitCode(exitConnectFailure, fmt.Errorf("failed to connect through proxy %s: %v", client.Proxy, err))
+	}
+	return withExitCode(exitConnectFailure, fmt.Errorf("failed to connect: %v", err))
+}
 
-			// Get chat info
-			chatInfo := "Private Message"
-			if v.Info.Chat.Server == "g.us" {
-				chatInfo = "Group Message"
-			}
+// notLoggedInMessage explains why a command needing a session can't run.
+func notLoggedInMessage(client *whatsappclient.Client) string {
+	return fmt.Sprintf("No registered device found in %s. Please run 'go run . qr' first to log in.", client.DBPath)
+}
 
-			// Print message details
-			fmt.Printf("\n=== New Message ===\n")
-			fmt.Printf("From: %s\n", senderInfo)
-			fmt.Printf("Type: %s\n", chatInfo)
-			if v.Info.Chat.Server == "g.us" {
-				fmt.Printf("Group: %s\n", v.Info.Chat.User)
-			}
-			fmt.Printf("Time: %s\n", v.Info.Timestamp.Local().Format("2006-01-02 15:04:05"))
-			fmt.Printf("Content: %s\n", content)
-			fmt.Println("=================")
+// listenForMessages implements message, and watch, which is the same
+// listener printing one line per message.
+func listenForMessages(ctx context.Context, name string, args []string) error {
+	fs := newFlagSet(name)
+	showAppState := fs.Bool("appstate", false, "print contact and chat app-state changes made on other devices")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this host:port at /metrics")
+	healthAddr := fs.String("health-addr", "", "serve /healthz and /readyz (200 only while connected and logged in) on this host:port")
+	showGroupEvents := fs.Bool("group-events", false, "print group joins and group metadata changes")
+	showCalls := fs.Bool("calls", false, "print incoming call events")
+	rejectCalls := fs.Bool("reject-calls", false, "automatically reject incoming calls")
+	showSecurity := fs.Bool("security-events", false, "print contacts' safety number (identity key) changes")
+	showReceipts := fs.Bool("receipts", false, "print delivered, read and played receipts for sent messages")
+	showLatency := fs.Bool("latency", false, "log how long each message took to arrive, and print min/avg/max on exit")
+	requestRetries := fs.Bool("request-retries", false, "log undecryptable messages and ask the phone to resend those the sender doesn't")
+	storeMessages := fs.Bool("store-messages", false, "record received messages in the local database (needed by download)")
+	outputPath := fs.String("output", "", "also append each message to this file (reopened on SIGHUP)")
+	redact := fs.Bool("redact", false, "mask message text, captions and file names in printed output, --output and webhooks, keeping the metadata")
+	sinceFlag := fs.String("since", "", "skip messages sent before this RFC3339 time, including offline backlog")
+	staleTimeout := fs.Duration("stale-timeout", 0, "reconnect when nothing is received for this long and a ping fails, e.g. 10m (0 = off)")
+	verbose := fs.Bool("verbose", false, "print keepalive timeouts and recoveries, and skipped duplicate messages")
+	replyPrefix := fs.String("reply-prefix", "", "auto-reply to bot commands starting with this prefix, e.g. ! for !ping and !time")
+	count := fs.Int("count", 0, "exit after receiving this many messages (0 = run until interrupted)")
+	ignoreSelf := fs.Bool("ignore-self", false, "skip messages sent from this account's own devices")
+	// watch is the listener for following along, so it defaults to one
+	// line per message
+	defaultFormat := "text"
+	if name == "watch" {
+		defaultFormat = "compact"
+	}
+	var format formatOptions
+	format.register(fs, defaultFormat)
+	registerJIDFormat(fs)
+	var filter messageFilter
+	filter.register(fs)
+	var downloads autoDownloadOptions
+	downloads.register(fs)
+	var dedup dedupOptions
+	dedup.register(fs)
+	var streamReplaced streamReplacedPolicy
+	streamReplaced.register(fs)
+	var schedule scheduleOptions
+	schedule.register(fs)
+	webhook := bindSetting(fs, webhookSetting)
+	stateHook := bindSetting(fs, stateWebhookSetting)
+	storePath := bindSetting(fs, messagesDBSetting)
+	parseCommandFlags(fs, args, webhook, stateHook, storePath)
+
+	// --count ends the listener by cancelling its context
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var received atomic.Int64
+	// replaced is set when the exit policy ends the listener
+	var replaced atomic.Bool
+
+	var since time.Time
+	if *sinceFlag != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, *sinceFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --since time %q (want RFC3339, e.g. 2024-01-02T15:04:05Z)", *sinceFlag)
 		}
-	})
-
-	if client.Store.ID == nil {
-		fmt.Println("No existing login found. Please run 'go run main.go qr' first to log in.")
-		return
 	}
-
-	err = client.Connect()
+	stdoutFormat, fileFormat, err := format.build(fs)
 	if err != nil {
-		fmt.Printf("Failed to connect: %v\n", err)
-		return
+		return err
+	}
+	if err := validateJIDFormat(); err != nil {
+		return err
+	}
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	if err := downloads.validate(); err != nil {
+		return err
+	}
+	if err := dedup.validate(); err != nil {
+		return err
+	}
+	if err := streamReplaced.validate(); err != nil {
+		return err
+	}
+	if err := schedule.validate(); err != nil {
+		return err
 	}
 
-	fmt.Println("Connected successfully!")
-	fmt.Println("Listening for messages... (Press Ctrl+C to exit)")
-
-	// Handle interrupt signal
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to set up client: %v", err)
+	}
+	applyJIDFormat(client.Store.Contacts)
 
-	client.Disconnect()
-}
+	sink, err := openMessageSink(client, *storeMessages, *outputPath, stdoutFormat, fileFormat)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	sink.redact = *redact
+	downloads.redact = *redact
 
-func generateQR() {
-	client, err := setupClient()
+	deduper, err := newMessageDeduper(dedup, client.DBPath)
 	if err != nil {
-		fmt.Printf("Error setting up client: %v\n", err)
-		return
+		return err
 	}
+	defer deduper.Close()
 
-	// Add event handler to monitor connection status
-	client.AddEventHandler(func(evt interface{}) {
-		switch evt.(type) {
-		case *events.Connected:
-			fmt.Println("Connected to WhatsApp!")
-		case *events.StreamReplaced:
-			fmt.Println("Connection replaced by another login")
-			os.Exit(1)
-		case *events.LoggedOut:
-			fmt.Println("Device logged out!")
-			os.Exit(1)
-		case *events.PushNameSetting:
-			fmt.Printf("Push name changed")
+	var scheduled *scheduleStore
+	if schedule.enabled {
+		if scheduled, err = openScheduleStore(client.DBPath); err != nil {
+			return err
 		}
-	})
+		defer scheduled.Close()
+	}
 
-	qrChan, _ := client.GetQRChannel(context.Background())
-	err = client.Connect()
-	if err != nil {
-		fmt.Printf("Failed to connect: %v\n", err)
-		return
+	var retries *retryRequester
+	if *requestRetries {
+		retries = newRetryRequester(client)
 	}
+	if downloads.dir != "" && !downloads.thumbnailsOnly {
+		downloads.retries = newMediaRetrier(client)
+	}
+
+	// Add message handler
+	client.AddEventHandler(func(evt interface{}) {
+		if handleConnectionFailure(evt) {
+			return
+		}
 
-	fmt.Println("Waiting for QR code...")
-	loginSuccess := false
+		switch v := evt.(type) {
+		case *events.Message:
+			retries.received(v.Info.ID)
+			// Offline messages delivered on reconnect arrive as ordinary
+			// message events, so this also drops an already-seen backlog
+			if !since.IsZero() && v.Info.Timestamp.Before(since) {
+				return
+			}
+			if *ignoreSelf && v.Info.IsFromMe {
+				return
+			}
+			msg := whatsappclient.NewEvent(v)
+			if !filter.match(msg) {
+				return
+			}
+			if deduper.seen(v.Info.Chat, v.Info.ID, time.Now()) {
+				if *verbose {
+					fmt.Printf("[Dedup] Skipped redelivered message %s\n", v.Info.ID)
+				}
+				return
+			}
 
-	for evt := range qrChan {
-		if evt.Event == "code" {
-			qr, err := qrcode.New(evt.Code, qrcode.Medium)
-			if err != nil {
-				fmt.Printf("Failed to generate QR code: %v\n", err)
-				continue
+			n := received.Add(1)
+			if *count > 0 && n > int64(*count) {
+				return
 			}
 
-			art := qr.ToSmallString(false)
-			art = strings.TrimSpace(art)
+			sink.record(msg)
 
-			fmt.Println("Scan this QR code in WhatsApp:")
-			fmt.Println(art)
-		} else if evt.Event == "success" {
-			loginSuccess = true
-			fmt.Println("QR code scanned successfully!")
-			fmt.Println("Waiting for full login to complete...")
+			if webhookURL != "" {
+				payload := msg
+				if *redact {
+					payload = redactEvent(msg)
+				}
+				go postWebhook(webhookURL, payload)
+			}
 
-			// Wait for initial connection
-			time.Sleep(15 * time.Second)
+			go downloads.download(client, msg)
 
-			if client.Store.ID == nil {
-				fmt.Println("Error: Failed to get device ID after login")
-				return
+			if *replyPrefix != "" {
+				go handleBotCommand(ctx, client, *replyPrefix, msg)
 			}
 
-			fmt.Printf("Successfully logged in as %s\n", client.Store.ID.String())
-
-			// Force a store flush to ensure data is written to database
-			err = client.Store.Save()
-			if err != nil {
-				fmt.Printf("Error saving to database: %v\n", err)
-				return
+			if *count > 0 && n == int64(*count) {
+				fmt.Printf("Received %d messages, exiting\n", n)
+				cancel()
+			}
+		case *events.Contact, *events.PushName, *events.Pin, *events.Mute, *events.Archive:
+			if *showAppState {
+				printAppStateEvent(v)
 			}
+		case *events.Blocklist:
+			if *showAppState {
+				go printBlocklistEvent(client, v)
+			}
+		case *events.DeleteForMe, *events.ClearChat, *events.DeleteChat:
+			// Keep the stored history in line with the phone even when the
+			// deletions aren't printed
+			sink.applyDeletion(v)
+			if *showAppState {
+				printAppStateEvent(v)
+			}
+		case *events.JoinedGroup, *events.GroupInfo:
+			if *showGroupEvents {
+				printGroupEvent(v)
+			}
+		case *events.IdentityChange:
+			if *showSecurity {
+				printSecurityEvent(v)
+			}
+		case *events.StreamReplaced:
+			if streamReplaced.handle(ctx, client) {
+				replaced.Store(true)
+				cancel()
+			}
+		case *events.UndecryptableMessage:
+			retries.undecryptable(ctx, v)
+		case *events.MediaRetry:
+			go downloads.retried(client, v)
+		case *events.Receipt:
+			if *showReceipts {
+				printReceiptEvent(v)
+			}
+		case *events.KeepAliveTimeout, *events.KeepAliveRestored:
+			if *verbose {
+				printKeepAliveEvent(v)
+			}
+		case *events.CallOffer, *events.CallOfferNotice, *events.CallAccept, *events.CallReject, *events.CallTerminate:
+			if *showCalls {
+				printCallEvent(v)
+			}
+			if offer, ok := v.(*events.CallOffer); ok && *rejectCalls {
+				go rejectCall(client, offer)
+			}
+		}
+	})
 
-			fmt.Println("\nStarting initial sync...")
-			fmt.Println("Please wait for the sync to complete (this may take a few minutes)")
-			fmt.Println("You should see your WhatsApp contacts and chats appear on your phone")
-			fmt.Println("Press Ctrl+C when the sync is complete")
+	if !isLoggedIn(client) {
+		return errNotLoggedIn(client)
+	}
 
-			// Add handler for sync status
-			client.AddEventHandler(func(evt interface{}) {
-				switch v := evt.(type) {
-				case *events.AppStateSyncComplete:
-					fmt.Printf("Sync completed for %s\n", v.Name)
-				}
-			})
-		} else {
-			fmt.Println("Login event:", evt.Event)
+	if *metricsAddr != "" {
+		metrics := newListenerMetrics()
+		client.AddEventHandler(metrics.handleEvent)
+		srv, err := metrics.serve(*metricsAddr)
+		if err != nil {
+			return fmt.Errorf("failed to start metrics server: %v", err)
 		}
+		defer shutdownServer(srv)
+		fmt.Printf("Serving metrics on http://%s/metrics\n", *metricsAddr)
 	}
 
-	if !loginSuccess {
-		fmt.Println("QR code scanning was not completed successfully")
-		return
+	if *healthAddr != "" {
+		srv, err := serveHealth(*healthAddr, client)
+		if err != nil {
+			return fmt.Errorf("failed to start health server: %v", err)
+		}
+		defer shutdownServer(srv)
+		fmt.Printf("Serving health checks on http://%s/healthz and /readyz\n", *healthAddr)
+	}
+
+	if stateWebhookURL != "" {
+		client.AddEventHandler((&stateWebhook{url: stateWebhookURL, jid: client.Store.ID.String()}).handleEvent)
 	}
 
-	// Keep connection open and wait for interrupt signal
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	if markers := newReconnectMarkers(stdoutFormat); markers != nil {
+		client.AddEventHandler(markers.handleEvent)
+	}
 
-	fmt.Println("\nDisconnecting safely...")
+	var latency *latencyTracker
+	if *showLatency {
+		latency = newLatencyTracker()
+		client.AddEventHandler(latency.handleEvent)
+	}
 
-	// Force final save before disconnecting
-	err = client.Store.Save()
+	err = client.Connect()
 	if err != nil {
-		fmt.Printf("Error saving final state to database: %v\n", err)
+		return errConnectFailed(client, err)
 	}
 
-	client.Disconnect()
+	fmt.Println("Connected successfully!")
+	fmt.Println("Listening for messages... (Press Ctrl+C to exit)")
 
-	// Verify the database
-	verifyClient, err := setupClient()
-	if err != nil {
-		fmt.Printf("Error verifying credentials: %v\n", err)
-		return
+	if latency != nil {
+		go latency.measureSkew(ctx, client)
 	}
 
-	if verifyClient.Store.ID == nil {
-		fmt.Println("Error: Device ID was not properly saved to database")
-		return
+	if scheduled != nil {
+		go schedule.run(ctx, client, scheduled, time.Now())
+	}
+
+	if *staleTimeout > 0 {
+		watchdog := newConnectionWatchdog(*staleTimeout)
+		client.AddEventHandler(watchdog.handleEvent)
+		go watchdog.run(ctx, client)
 	}
 
-	fmt.Printf("Verification successful! Device ID: %s\n", verifyClient.Store.ID.String())
-	fmt.Println("\nYou can now use 'go run main.go message' to listen for messages")
+	<-ctx.Done()
+
+	if latency != nil {
+		latency.summary()
+	}
+	if err := client.SaveStore(); err != nil {
+		fmt.Printf("Error saving to database: %v\n", err)
+	}
+	client.Disconnect()
+	if replaced.Load() {
+		return errStreamReplaced
+	}
+	return nil
 }
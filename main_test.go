@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// fakeMessenger records sends instead of talking to WhatsApp.
+type fakeMessenger struct {
+	self    types.JID
+	sendErr map[string]error
+	sent    []fakeSend
+	// media is returned by Download, which fails when it's nil
+	media      []byte
+	downloaded []whatsmeow.DownloadableMessage
+	timers     []types.JID
+}
+
+type fakeSend struct {
+	to  types.JID
+	msg *waE2E.Message
+}
+
+func (f *fakeMessenger) Connect() error { return nil }
+func (f *fakeMessenger) Disconnect()    {}
+
+func (f *fakeMessenger) ResolveRecipient(recipient string) (types.JID, error) {
+	if whatsappclient.IsSelf(recipient) {
+		return f.self, nil
+	}
+	return whatsappclient.ParseRecipient(recipient)
+}
+
+func (f *fakeMessenger) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if err := f.sendErr[to.User]; err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+	f.sent = append(f.sent, fakeSend{to: to, msg: message})
+	return whatsmeow.SendResponse{ID: "FAKE", Timestamp: time.Unix(0, 0)}, nil
+}
+
+func (f *fakeMessenger) Download(msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	f.downloaded = append(f.downloaded, msg)
+	if f.media == nil {
+		return nil, errors.New("not supported by the fake")
+	}
+	return f.media, nil
+}
+
+func (f *fakeMessenger) Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	return whatsmeow.UploadResponse{}, errors.New("not supported by the fake")
+}
+
+func (f *fakeMessenger) UploadReader(ctx context.Context, plaintext io.Reader, tempFile io.ReadWriteSeeker, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	return whatsmeow.UploadResponse{}, errors.New("not supported by the fake")
+}
+
+func (f *fakeMessenger) GetGroupInfo(jid types.JID) (*types.GroupInfo, error) {
+	return nil, errors.New("not supported by the fake")
+}
+
+func (f *fakeMessenger) SetDisappearingTimer(chat types.JID, timer time.Duration) error {
+	f.timers = append(f.timers, chat)
+	return nil
+}
+
+// useFakeMessenger makes the send commands use a fake for the test.
+func useFakeMessenger(t *testing.T) *fakeMessenger {
+	fake := &fakeMessenger{self: types.NewJID("15550000000", types.DefaultUserServer)}
+	orig := connectMessenger
+	connectMessenger = func() (messenger, error) { return fake, nil }
+	t.Cleanup(func() { connectMessenger = orig })
+	return fake
+}
+
+func TestParseRecipient(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "15551234567", want: "15551234567@s.whatsapp.net"},
+		{in: "+1 (555) 123-4567", want: "15551234567@s.whatsapp.net"},
+		{in: "  15551234567  ", want: "15551234567@s.whatsapp.net"},
+		{in: "15551234567@s.whatsapp.net", want: "15551234567@s.whatsapp.net"},
+		{in: "120363025246125486@g.us", want: "120363025246125486@g.us"},
+		{in: "", wantErr: true},
+		{in: "   ", wantErr: true},
+		{in: "+", wantErr: true},
+		{in: "555-CALL-NOW", wantErr: true},
+		{in: "me", wantErr: true},
+	}
+	for _, tt := range tests {
+		jid, err := whatsappclient.ParseRecipient(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseRecipient(%q) = %s, want an error", tt.in, jid)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRecipient(%q) failed: %v", tt.in, err)
+		} else if jid.String() != tt.want {
+			t.Errorf("ParseRecipient(%q) = %s, want %s", tt.in, jid, tt.want)
+		}
+	}
+}
+
+func TestValidateRecipient(t *testing.T) {
+	for _, in := range []string{"me", "Self", "15551234567", "123@g.us"} {
+		if err := whatsappclient.ValidateRecipient(in); err != nil {
+			t.Errorf("ValidateRecipient(%q) failed: %v", in, err)
+		}
+	}
+	for _, in := range []string{"", "abc", "12 34x"} {
+		if err := whatsappclient.ValidateRecipient(in); err == nil {
+			t.Errorf("ValidateRecipient(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestExtractContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         *waE2E.Message
+		wantType    string
+		wantContent string
+	}{
+		{"conversation", &waE2E.Message{Conversation: proto.String("hi")}, whatsappclient.TypeText, "hi"},
+		{"extended text", &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String("hello")}}, whatsappclient.TypeText, "hello"},
+		{"image", &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("cat")}}, whatsappclient.TypeImage, "[Image] Caption: cat"},
+		{"video", &waE2E.Message{VideoMessage: &waE2E.VideoMessage{}}, whatsappclient.TypeVideo, "[Video] Caption: "},
+		{"document", &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{FileName: proto.String("a.pdf")}}, whatsappclient.TypeDocument, "[Document] Filename: a.pdf"},
+		{"audio", &waE2E.Message{AudioMessage: &waE2E.AudioMessage{}}, whatsappclient.TypeAudio, "[Audio]"},
+		{"voice", &waE2E.Message{AudioMessage: &waE2E.AudioMessage{PTT: proto.Bool(true)}}, whatsappclient.TypeVoice, "[Voice Message]"},
+		{"sticker", &waE2E.Message{StickerMessage: &waE2E.StickerMessage{}}, whatsappclient.TypeSticker, "[Sticker]"},
+		{"location", &waE2E.Message{LocationMessage: &waE2E.LocationMessage{
+			DegreesLatitude: proto.Float64(-33.8), DegreesLongitude: proto.Float64(151.2), Name: proto.String("Opera House"),
+		}}, whatsappclient.TypeLocation, "[Location] -33.800000,151.200000 Opera House "},
+		{"reaction", &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{
+			Text: proto.String("👍"), Key: &waCommon.MessageKey{ID: proto.String("ABC")},
+		}}, whatsappclient.TypeReaction, "[Reaction] 👍 to message: ABC"},
+		{"contact", &waE2E.Message{ContactMessage: &waE2E.ContactMessage{DisplayName: proto.String("Ann")}}, whatsappclient.TypeContact, "[Contact] Ann"},
+		{"contacts", &waE2E.Message{ContactsArrayMessage: &waE2E.ContactsArrayMessage{Contacts: []*waE2E.ContactMessage{
+			{DisplayName: proto.String("Ann")}, {DisplayName: proto.String("Bob")},
+		}}}, whatsappclient.TypeContact, "[Contacts] Ann, Bob"},
+		{"empty", &waE2E.Message{}, whatsappclient.TypeUnknown, "[Unknown Message Type]"},
+	}
+	for _, tt := range tests {
+		gotType, gotContent := whatsappclient.ExtractContent(tt.msg)
+		if gotType != tt.wantType || gotContent != tt.wantContent {
+			t.Errorf("%s: ExtractContent = (%q, %q), want (%q, %q)", tt.name, gotType, gotContent, tt.wantType, tt.wantContent)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		lat, lng string
+		wantErr  string
+	}{
+		{lat: "-33.8568", lng: "151.2153"},
+		{lat: "90", lng: "-180"},
+		{lat: "abc", lng: "0", wantErr: "invalid latitude"},
+		{lat: "0", lng: "east", wantErr: "invalid longitude"},
+		{lat: "90.1", lng: "0", wantErr: "latitude 90.1 out of range"},
+		{lat: "0", lng: "-180.5", wantErr: "longitude -180.5 out of range"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseLocation(tt.lat, tt.lng)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("parseLocation(%q, %q) failed: %v", tt.lat, tt.lng, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseLocation(%q, %q) = %v, want an error containing %q", tt.lat, tt.lng, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSendLocation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+		wantTo  string
+	}{
+		{name: "too few args", args: []string{"15551234567", "1"}, wantErr: "usage"},
+		{name: "too many args", args: []string{"15551234567", "1", "2", "a", "b", "c"}, wantErr: "usage"},
+		{name: "bad recipient", args: []string{"nobody", "1", "2"}, wantErr: "invalid phone number"},
+		{name: "bad latitude", args: []string{"15551234567", "-91", "2"}, wantErr: "latitude"},
+		{name: "negative coordinates", args: []string{"15551234567", "-33.8", "-151.2", "Somewhere"}, wantTo: "15551234567@s.whatsapp.net"},
+		{name: "self", args: []string{"me", "1", "2"}, wantTo: "15550000000@s.whatsapp.net"},
+	}
+	for _, tt := range tests {
+		fake := useFakeMessenger(t)
+		err := sendLocation(context.Background(), tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.wantErr)
+			}
+			if len(fake.sent) != 0 {
+				t.Errorf("%s: sent %d messages after invalid arguments", tt.name, len(fake.sent))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed: %v", tt.name, err)
+			continue
+		}
+		if len(fake.sent) != 1 || fake.sent[0].to.String() != tt.wantTo || fake.sent[0].msg.GetLocationMessage() == nil {
+			t.Errorf("%s: sent %+v, want one location to %s", tt.name, fake.sent, tt.wantTo)
+		}
+	}
+}
+
+func TestSendText(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		sendErr  map[string]error
+		wantErr  string
+		wantCode int
+		wantSent int
+	}{
+		{name: "no text", args: []string{"15551234567"}, wantErr: errUsage.Error()},
+		{name: "empty text", args: []string{"15551234567", "  "}, wantErr: "message text is empty"},
+		{name: "bad recipient", args: []string{"15551234567,x", "hi"}, wantErr: "invalid phone number"},
+		{name: "one", args: []string{"15551234567", "hi"}, wantSent: 1},
+		{name: "comma list", args: []string{"--rate", "0", "15551234567,15557654321", "me", "hi"}, wantSent: 3},
+		{name: "one fails", args: []string{"--rate", "0", "--retries", "0", "15551234567,15557654321", "hi"},
+			sendErr: map[string]error{"15557654321": errors.New("boom")}, wantErr: "1 of 2 messages failed", wantCode: exitSendFailure, wantSent: 1},
+	}
+	for _, tt := range tests {
+		fake := useFakeMessenger(t)
+		fake.sendErr = tt.sendErr
+		err := sendText(context.Background(), tt.args)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: failed: %v", tt.name, err)
+		} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.wantErr)
+		}
+		if tt.wantCode != 0 && exitCodeFor(err) != tt.wantCode {
+			t.Errorf("%s: exit code %d, want %d", tt.name, exitCodeFor(err), tt.wantCode)
+		}
+		if len(fake.sent) != tt.wantSent {
+			t.Errorf("%s: sent %d messages, want %d", tt.name, len(fake.sent), tt.wantSent)
+		}
+	}
+}
+
+func TestEphemeralApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     *waE2E.Message
+		wantErr bool
+	}{
+		{name: "text", msg: &waE2E.Message{Conversation: proto.String("hi")}},
+		{name: "voice", msg: &waE2E.Message{AudioMessage: &waE2E.AudioMessage{PTT: proto.Bool(true)}}},
+		{name: "sticker", msg: &waE2E.Message{StickerMessage: &waE2E.StickerMessage{}}},
+		{name: "contact", msg: &waE2E.Message{ContactMessage: &waE2E.ContactMessage{DisplayName: proto.String("Ann")}}},
+		{name: "contacts", msg: &waE2E.Message{ContactsArrayMessage: &waE2E.ContactsArrayMessage{DisplayName: proto.String("2 contacts")}}},
+		{name: "reaction", msg: &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{Text: proto.String("👍")}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		fake := &fakeMessenger{}
+		o := ephemeralOptions{value: "7d", chatTimer: true}
+		if err := o.validate(); err != nil {
+			t.Fatal(err)
+		}
+		err := o.apply(fake, "15551234567", tt.msg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: applied, want an error", tt.name)
+			}
+			if len(fake.timers) != 0 {
+				t.Errorf("%s: chat timer set for a message that can't disappear", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed: %v", tt.name, err)
+			continue
+		}
+		if ctxInfo := contextInfoOf(tt.msg); ctxInfo == nil || (*ctxInfo).GetExpiration() != uint32((7*24*time.Hour).Seconds()) {
+			t.Errorf("%s: expiration not set: %v", tt.name, tt.msg)
+		}
+		if len(fake.timers) != 1 {
+			t.Errorf("%s: chat timer set %d times, want 1", tt.name, len(fake.timers))
+		}
+	}
+}
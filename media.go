@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// Media kinds accepted by sendMedia, matching the send-<kind> command names.
+const (
+	mediaImage    = "image"
+	mediaVideo    = "video"
+	mediaDocument = "document"
+	mediaVoice    = "voice"
+)
+
+// mediaLimitFor returns WhatsApp's maximum file size for a media kind.
+func mediaLimitFor(kind string) int64 {
+	switch kind {
+	case mediaImage, mediaVideo, mediaVoice:
+		return 16 << 20
+	default:
+		return 100 << 20
+	}
+}
+
+// formatSize renders a byte count in MB, the unit WhatsApp's limits use.
+func formatSize(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+// checkMediaSize refuses files over the WhatsApp limit for kind, which
+// Upload would otherwise reject with an unhelpful error.
+func checkMediaSize(kind, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if limit := mediaLimitFor(kind); info.Size() > limit {
+		return fmt.Errorf("%s is %s, over WhatsApp's %s limit for %ss (use --force to try anyway)", filepath.Base(path), formatSize(info.Size()), formatSize(limit), kind)
+	}
+	return nil
+}
+
+// mediaOptions holds the flags shared by the send-image/video/document commands.
+type mediaOptions struct {
+	caption     string
+	replyTo     string
+	replySender string
+	// thumbnail is an image to preview a document with
+	thumbnail string
+}
+
+// validate checks the reply flags before connecting.
+func (o mediaOptions) validate() error {
+	if o.replyTo == "" && o.replySender == "" {
+		return nil
+	}
+	if o.replyTo == "" || o.replySender == "" {
+		return fmt.Errorf("--reply-to and --reply-sender must be given together")
+	}
+	if err := whatsappclient.ValidateRecipient(o.replySender); err != nil {
+		return fmt.Errorf("invalid --reply-sender: %v", err)
+	}
+	return nil
+}
+
+// contextInfo builds the quoted-reply context for the media message, or nil
+// when no reply was requested.
+func (o mediaOptions) contextInfo(m messenger) (*waE2E.ContextInfo, error) {
+	if o.replyTo == "" {
+		return nil, nil
+	}
+
+	sender, err := m.ResolveRecipient(o.replySender)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --reply-sender: %v", err)
+	}
+
+	return &waE2E.ContextInfo{
+		StanzaID:    proto.String(o.replyTo),
+		Participant: proto.String(sender.ToNonAD().String()),
+		// The original isn't stored locally, so quote it with an empty body;
+		// WhatsApp still links the reply to the referenced stanza
+		QuotedMessage: &waE2E.Message{Conversation: proto.String("")},
+	}, nil
+}
+
+// mimeTypeFor guesses the MIME type of a file from its name, falling back
+// to sniffing the content.
+func mimeTypeFor(path string, data []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+// buildMediaMessage uploads data and wraps the result in a message of the
+// given kind, attaching ctxInfo to the media message itself so it threads
+// as a reply.
+func buildMediaMessage(ctx context.Context, m messenger, kind, path string, data []byte, caption string, ctxInfo *waE2E.ContextInfo) (*waE2E.Message, error) {
+	var mediaType whatsmeow.MediaType
+	switch kind {
+	case mediaImage:
+		mediaType = whatsmeow.MediaImage
+	case mediaVideo:
+		mediaType = whatsmeow.MediaVideo
+	case mediaDocument:
+		mediaType = whatsmeow.MediaDocument
+	case mediaVoice:
+		mediaType = whatsmeow.MediaAudio
+	default:
+		return nil, fmt.Errorf("unsupported media kind %q", kind)
+	}
+
+	// Check the voice note before spending an upload on it
+	var voice *oggOpusInfo
+	if kind == mediaVoice {
+		var err error
+		if voice, err = parseOggOpus(data); err != nil {
+			return nil, fmt.Errorf("%s: %v; voice notes must be Ogg Opus, e.g. ffmpeg -i in.m4a -c:a libopus out.ogg", filepath.Base(path), err)
+		}
+	}
+
+	uploaded, err := uploadMedia(ctx, m, data, mediaType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %v", kind, err)
+	}
+
+	mimeType := mimeTypeFor(path, data)
+	switch kind {
+	case mediaImage:
+		return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   ctxInfo,
+		}}, nil
+	case mediaVideo:
+		return &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   ctxInfo,
+		}}, nil
+	case mediaVoice:
+		return &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			PTT:           proto.Bool(true),
+			Seconds:       proto.Uint32(uint32(voice.duration.Round(time.Second).Seconds())),
+			Waveform:      voiceWaveform(voice.packetSizes),
+			Mimetype:      proto.String(voiceMimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   ctxInfo,
+		}}, nil
+	default:
+		fileName := filepath.Base(path)
+		return &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			Caption:       proto.String(caption),
+			Title:         proto.String(fileName),
+			FileName:      proto.String(fileName),
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   ctxInfo,
+		}}, nil
+	}
+}
+
+func sendMedia(ctx context.Context, kind string, args []string) error {
+	fs := newFlagSet("send-" + kind)
+	var opts mediaOptions
+	// Voice notes have no caption
+	if kind != mediaVoice {
+		fs.StringVar(&opts.caption, "caption", "", "caption to show under the "+kind)
+	}
+	if kind == mediaDocument {
+		fs.StringVar(&opts.thumbnail, "thumbnail", "", "JPEG or PNG preview to show instead of the file icon (default: the first page of a PDF, if pdftoppm is installed)")
+	}
+	fs.StringVar(&opts.replyTo, "reply-to", "", "stanza ID of the message to reply to")
+	fs.StringVar(&opts.replySender, "reply-sender", "", "JID or phone number of the sender of the message being replied to")
+	force := fs.Bool("force", false, "send even if the file is over WhatsApp's size limit")
+	var ephemeral ephemeralOptions
+	ephemeral.register(fs)
+	retries := bindSetting(fs, uploadRetriesSetting)
+	args = parseCommandFlags(fs, args, retries)
+
+	if len(args) != 2 {
+		caption := " [--caption <text>]"
+		if kind == mediaVoice {
+			caption = ""
+		}
+		if kind == mediaDocument {
+			caption += " [--thumbnail <image>]"
+		}
+		fmt.Printf("Usage: send-%s <recipient> <path>%s [--reply-to <stanza-id> --reply-sender <jid>]\n", kind, caption)
+		return errUsage
+	}
+
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if err := ephemeral.validate(); err != nil {
+		return err
+	}
+	if err := applyUploadRetries(); err != nil {
+		return err
+	}
+
+	if !*force {
+		if err := checkMediaSize(kind, args[1]); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+
+	thumbnail, err := documentThumbnailFor(ctx, kind, args[1], data, opts.thumbnail)
+	if err != nil {
+		return err
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	ctxInfo, err := opts.contextInfo(client)
+	if err != nil {
+		return err
+	}
+
+	msg, err := buildMediaMessage(ctx, client, kind, args[1], data, opts.caption, ctxInfo)
+	if err != nil {
+		return err
+	}
+	thumbnail.apply(msg)
+
+	if err := ephemeral.apply(client, args[0], msg); err != nil {
+		return err
+	}
+
+	return sendAndReport(ctx, client, args[0], msg, kind)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// mediaRetryTimeout is how long to wait for the sender's phone to answer a
+// media retry request before giving up on the download.
+const mediaRetryTimeout = 5 * time.Minute
+
+// mediaRetrier asks the sender's phone to upload media again when it has
+// expired from WhatsApp's servers, which happens to old media and to large
+// files that were never fetched. The phone answers with a MediaRetry event
+// carrying the new location of the media.
+type mediaRetrier struct {
+	client *whatsappclient.Client
+
+	lock    sync.Mutex
+	pending map[types.MessageID]whatsappclient.Event
+}
+
+func newMediaRetrier(client *whatsappclient.Client) *mediaRetrier {
+	return &mediaRetrier{client: client, pending: make(map[types.MessageID]whatsappclient.Event)}
+}
+
+// request asks for msg's media to be uploaded again. It reports whether the
+// request was sent; a message is only retried once.
+func (r *mediaRetrier) request(msg whatsappclient.Event, mediaKey []byte) bool {
+	if r == nil {
+		return false
+	}
+	r.lock.Lock()
+	if _, ok := r.pending[msg.ID]; ok {
+		r.lock.Unlock()
+		return false
+	}
+	r.pending[msg.ID] = msg
+	r.lock.Unlock()
+
+	if err := r.client.SendMediaRetryReceipt(&msg.Raw.Info, mediaKey); err != nil {
+		fmt.Printf("[Download] Failed to request media of message %s again: %v\n", msg.ID, err)
+		r.take(msg.ID)
+		return false
+	}
+	time.AfterFunc(mediaRetryTimeout, func() {
+		if _, ok := r.take(msg.ID); ok {
+			fmt.Printf("[Download] Sender's phone didn't upload message %s again within %s\n", msg.ID, mediaRetryTimeout)
+		}
+	})
+	return true
+}
+
+// take removes and returns the message a retry was requested for.
+func (r *mediaRetrier) take(id types.MessageID) (whatsappclient.Event, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	msg, ok := r.pending[id]
+	delete(r.pending, id)
+	return msg, ok
+}
+
+// retried handles the phone's answer to a retry request, downloading the
+// media from its new location. It blocks for the length of the download.
+func (o *autoDownloadOptions) retried(m messenger, evt *events.MediaRetry) {
+	if o.retries == nil {
+		return
+	}
+	msg, ok := o.retries.take(evt.MessageID)
+	if !ok {
+		return
+	}
+	media, mimeType, fileName, err := downloadableFrom(msg.Raw.Message)
+	if err != nil {
+		return
+	}
+
+	notif, err := whatsmeow.DecryptMediaRetryNotification(evt, media.GetMediaKey())
+	if errors.Is(err, whatsmeow.ErrMediaNotAvailableOnPhone) {
+		fmt.Printf("[Download] Media of message %s is no longer on the sender's phone either\n", msg.ID)
+		return
+	} else if err != nil {
+		fmt.Printf("[Download] Failed to read the retry response for message %s: %v\n", msg.ID, err)
+		return
+	}
+	if notif.GetResult() != waMmsRetry.MediaRetryNotification_SUCCESS {
+		fmt.Printf("[Download] Sender's phone couldn't upload message %s again: %s\n", msg.ID, notif.GetResult())
+		return
+	}
+	setDirectPath(media, notif.GetDirectPath())
+
+	data, err := m.Download(media)
+	if err != nil {
+		fmt.Printf("[Download] Failed to download message %s after the retry: %v\n", msg.ID, err)
+		return
+	}
+	o.saveMedia(msg, data, mimeType, fileName)
+}
+
+// setDirectPath points media at where the phone uploaded it again. The old
+// URL is cleared, since downloads prefer it over the direct path and it
+// points at the expired copy.
+func setDirectPath(media whatsmeow.DownloadableMessage, path string) {
+	switch v := media.(type) {
+	case *waE2E.ImageMessage:
+		v.DirectPath, v.URL = &path, nil
+	case *waE2E.VideoMessage:
+		v.DirectPath, v.URL = &path, nil
+	case *waE2E.AudioMessage:
+		v.DirectPath, v.URL = &path, nil
+	case *waE2E.DocumentMessage:
+		v.DirectPath, v.URL = &path, nil
+	case *waE2E.StickerMessage:
+		v.DirectPath, v.URL = &path, nil
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.mau.fi/whatsmeow/util/gcmutil"
+	"go.mau.fi/whatsmeow/util/hkdfutil"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// retryResponse encrypts a successful retry notification the way the
+// sender's phone does.
+func retryResponse(t *testing.T, id types.MessageID, mediaKey []byte, directPath string) *events.MediaRetry {
+	plaintext, err := proto.Marshal(&waMmsRetry.MediaRetryNotification{
+		StanzaID:   proto.String(id),
+		DirectPath: proto.String(directPath),
+		Result:     waMmsRetry.MediaRetryNotification_SUCCESS.Enum(),
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal notification: %v", err)
+	}
+	key := hkdfutil.SHA256(mediaKey, nil, []byte("WhatsApp Media Retry Notification"), 32)
+	iv := make([]byte, 12)
+	ciphertext, err := gcmutil.Encrypt(key, iv, plaintext, []byte(id))
+	if err != nil {
+		t.Fatalf("failed to encrypt notification: %v", err)
+	}
+	return &events.MediaRetry{Ciphertext: ciphertext, IV: iv, MessageID: id}
+}
+
+func TestRetriedDownloadsRefreshedPath(t *testing.T) {
+	mediaKey := make([]byte, 32)
+	msg := whatsappclient.Event{
+		ID:   "3EB0ABC",
+		Type: whatsappclient.TypeImage,
+		Raw: &events.Message{Message: &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			URL:        proto.String("https://mmg.whatsapp.net/v/t62.7118-24/expired.enc"),
+			DirectPath: proto.String("/v/t62.7118-24/expired.enc"),
+			MediaKey:   mediaKey,
+			Mimetype:   proto.String("image/jpeg"),
+		}}},
+	}
+	dir := t.TempDir()
+	o := &autoDownloadOptions{dir: dir, images: true, retries: &mediaRetrier{
+		pending: map[types.MessageID]whatsappclient.Event{msg.ID: msg},
+	}}
+	fake := &fakeMessenger{media: []byte("jpeg")}
+
+	o.retried(fake, retryResponse(t, msg.ID, mediaKey, "/v/t62.7118-24/refreshed.enc"))
+
+	if len(fake.downloaded) != 1 {
+		t.Fatalf("%d downloads, want 1", len(fake.downloaded))
+	}
+	image, ok := fake.downloaded[0].(*waE2E.ImageMessage)
+	if !ok {
+		t.Fatalf("downloaded a %T, want the image", fake.downloaded[0])
+	}
+	if image.GetDirectPath() != "/v/t62.7118-24/refreshed.enc" || image.GetURL() != "" {
+		t.Errorf("downloaded from URL %q and path %q, want only the refreshed path", image.GetURL(), image.GetDirectPath())
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, msg.ID+".jpg")); err != nil || string(data) != "jpeg" {
+		t.Errorf("saved media = %q, %v", data, err)
+	}
+	if _, ok := o.retries.take(msg.ID); ok {
+		t.Errorf("message still pending after the retry")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// mentionOptions holds send's --mention flags.
+type mentionOptions struct {
+	values repeatedFlag
+	jids   []types.JID
+}
+
+func (o *mentionOptions) register(fs *flag.FlagSet) {
+	fs.Var(&o.values, "mention", "@-mention this group member, by phone number or JID (repeatable)")
+}
+
+// validate parses the mentioned users before connecting.
+func (o *mentionOptions) validate() error {
+	for _, v := range o.values {
+		jid, err := whatsappclient.ParseRecipient(v)
+		if err != nil {
+			return fmt.Errorf("invalid --mention %q: %v", v, err)
+		}
+		if jid.Server != types.DefaultUserServer {
+			return fmt.Errorf("invalid --mention %q: not a user", v)
+		}
+		o.jids = append(o.jids, jid.ToNonAD())
+	}
+	return nil
+}
+
+// formatText makes sure text has an @<number> token for every mentioned
+// user, appending any that are missing. WhatsApp only highlights a mention
+// where the token appears in the text.
+func (o *mentionOptions) formatText(text string) string {
+	for _, jid := range o.jids {
+		if token := "@" + jid.User; !strings.Contains(text, token) {
+			text += " " + token
+		}
+	}
+	return text
+}
+
+// apply checks that everyone mentioned is in the recipient group and
+// records the mentions in msg, which must be a text message.
+func (o *mentionOptions) apply(client messenger, recipient string, msg *waE2E.Message) error {
+	if len(o.jids) == 0 {
+		return nil
+	}
+	chat, err := client.ResolveRecipient(recipient)
+	if err != nil {
+		return err
+	}
+	if chat.Server != types.GroupServer {
+		return fmt.Errorf("--mention only works in group chats")
+	}
+
+	info, err := client.GetGroupInfo(chat)
+	if err != nil {
+		return fmt.Errorf("failed to get group info: %v", err)
+	}
+	members := make(map[types.JID]bool, len(info.Participants))
+	for _, p := range info.Participants {
+		members[p.JID.ToNonAD()] = true
+	}
+
+	mentioned := make([]string, 0, len(o.jids))
+	for _, jid := range o.jids {
+		if !members[jid] {
+			return fmt.Errorf("%s is not a member of %s", jid.User, chat.String())
+		}
+		mentioned = append(mentioned, jid.String())
+	}
+
+	// Conversation has no ContextInfo, so send an extended text message
+	if msg.Conversation != nil {
+		msg.ExtendedTextMessage = &waE2E.ExtendedTextMessage{Text: msg.Conversation}
+		msg.Conversation = nil
+	}
+	if msg.ExtendedTextMessage == nil {
+		return fmt.Errorf("--mention only works with text messages")
+	}
+	if msg.ExtendedTextMessage.ContextInfo == nil {
+		msg.ExtendedTextMessage.ContextInfo = &waE2E.ContextInfo{}
+	}
+	msg.ExtendedTextMessage.ContextInfo.MentionedJID = mentioned
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waSyncAction"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// messagesDB is where the message store lives when it shouldn't share the
+// session database, so history can be backed up or rotated on its own.
+var messagesDB string
+
+var messagesDBSetting = setting{
+	flag:   "messages-db",
+	env:    "WHATSAPP_MESSAGES_DB",
+	usage:  "keep stored messages in this SQLite file instead of the session database",
+	target: &messagesDB,
+}
+
+// messageStorePath returns the message store's database for the session
+// database at sessionDB.
+func messageStorePath(sessionDB string) string {
+	if messagesDB != "" {
+		return messagesDB
+	}
+	return sessionDB
+}
+
+// errMessageNotFound is returned by messageStore.Get for unknown message IDs.
+var errMessageNotFound = errors.New("message not found in local store")
+
+// messageStore persists received messages in SQLite so they can be looked
+// up by ID later, e.g. to download their media after the fact.
+type messageStore struct {
+	db *sql.DB
+	// fts is set when SQLite has FTS5 and the search index exists
+	fts bool
+}
+
+// storedMessage is a row of the messages table.
+type storedMessage struct {
+	Chat       types.JID
+	ID         string
+	Sender     types.JID
+	SenderName string
+	IsFromMe   bool
+	Timestamp  time.Time
+	Type       string
+	Content    string
+	// Message is the full decoded message, including media keys and URLs.
+	Message *waE2E.Message
+}
+
+const messagesSchema = `CREATE TABLE IF NOT EXISTS messages (
+	chat        TEXT    NOT NULL,
+	id          TEXT    NOT NULL,
+	sender      TEXT    NOT NULL,
+	sender_name TEXT    NOT NULL,
+	is_from_me  BOOLEAN NOT NULL,
+	timestamp   INTEGER NOT NULL,
+	type        TEXT    NOT NULL,
+	content     TEXT    NOT NULL,
+	raw         BLOB    NOT NULL,
+	PRIMARY KEY (chat, id)
+)`
+
+// openMessageStore opens the message store in the SQLite database at path,
+// creating the table if needed.
+func openMessageStore(path string) (*messageStore, error) {
+	db, err := clientOptions.DB.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open message store: %v", err)
+	}
+
+	if _, err := db.Exec(messagesSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create messages table: %v", err)
+	}
+
+	fts, err := createSearchIndex(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &messageStore{db: db, fts: fts}, nil
+}
+
+func (s *messageStore) Close() error {
+	return s.db.Close()
+}
+
+// Save stores msg, replacing any earlier copy with the same chat and ID.
+// The copy is updated in place rather than with INSERT OR REPLACE, whose
+// implicit delete would skip the triggers keeping the search index in sync.
+func (s *messageStore) Save(msg whatsappclient.Event) error {
+	raw, err := proto.Marshal(msg.Raw.Message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %v", err)
+	}
+
+	_, err = s.db.Exec(`INSERT INTO messages
+		(chat, id, sender, sender_name, is_from_me, timestamp, type, content, raw)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat, id) DO UPDATE SET
+			sender = excluded.sender, sender_name = excluded.sender_name,
+			is_from_me = excluded.is_from_me, timestamp = excluded.timestamp,
+			type = excluded.type, content = excluded.content, raw = excluded.raw`,
+		msg.Chat.String(), msg.ID, msg.Sender.String(), msg.SenderName, msg.IsFromMe,
+		msg.Timestamp.Unix(), msg.Type, msg.Content, raw)
+	if err != nil {
+		return fmt.Errorf("failed to store message: %v", err)
+	}
+	return nil
+}
+
+// Get loads the message with the given ID in chat.
+func (s *messageStore) Get(chat types.JID, id string) (*storedMessage, error) {
+	row := s.db.QueryRow(`SELECT chat, id, sender, sender_name, is_from_me, timestamp, type, content, raw
+		FROM messages WHERE chat = ? AND id = ?`, chat.String(), id)
+
+	var (
+		m         storedMessage
+		chatStr   string
+		senderStr string
+		timestamp int64
+		raw       []byte
+	)
+	err := row.Scan(&chatStr, &m.ID, &senderStr, &m.SenderName, &m.IsFromMe, &timestamp, &m.Type, &m.Content, &raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errMessageNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query message: %v", err)
+	}
+
+	m.Chat, _ = types.ParseJID(chatStr)
+	m.Sender, _ = types.ParseJID(senderStr)
+	m.Timestamp = time.Unix(timestamp, 0)
+	m.Message = &waE2E.Message{}
+	if err := proto.Unmarshal(raw, m.Message); err != nil {
+		return nil, fmt.Errorf("failed to decode stored message: %v", err)
+	}
+
+	return &m, nil
+}
+
+// Delete removes the message with the given ID in chat, if it is stored.
+func (s *messageStore) Delete(chat types.JID, id string) error {
+	if _, err := s.db.Exec(`DELETE FROM messages WHERE chat = ? AND id = ?`, chat.String(), id); err != nil {
+		return fmt.Errorf("failed to delete message: %v", err)
+	}
+	return nil
+}
+
+// DeleteChat removes the messages in chat sent at or before until, returning
+// how many were removed. A zero until removes all of them.
+func (s *messageStore) DeleteChat(chat types.JID, until time.Time) (int64, error) {
+	query, args := `DELETE FROM messages WHERE chat = ?`, []interface{}{chat.String()}
+	if !until.IsZero() {
+		query += ` AND timestamp <= ?`
+		args = append(args, until.Unix())
+	}
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete chat messages: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+// applyDeletion mirrors messages deleted for me, and chats cleared or
+// deleted, on another device. Clearing a chat can keep starred messages,
+// but starring isn't recorded here, so they are removed too.
+func (s *messageStore) applyDeletion(evt interface{}) error {
+	switch v := evt.(type) {
+	case *events.DeleteForMe:
+		return s.Delete(v.ChatJID, v.MessageID)
+	case *events.DeleteChat:
+		_, err := s.DeleteChat(v.JID, rangeEnd(v.Action.GetMessageRange()))
+		return err
+	case *events.ClearChat:
+		_, err := s.DeleteChat(v.JID, rangeEnd(v.Action.GetMessageRange()))
+		return err
+	}
+	return nil
+}
+
+// rangeEnd is the time of the last message an app-state action covers, so
+// messages received after the action was made on the phone are kept.
+func rangeEnd(r *waSyncAction.SyncActionMessageRange) time.Time {
+	if ts := r.GetLastMessageTimestamp(); ts > 0 {
+		return time.Unix(ts, 0)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// messenger is the subset of the whatsmeow client used by the send and
+// download paths, so they can run against a fake instead of the network.
+type messenger interface {
+	Connect() error
+	Disconnect()
+	ResolveRecipient(recipient string) (types.JID, error)
+	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	Download(msg whatsmeow.DownloadableMessage) ([]byte, error)
+	Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+	UploadReader(ctx context.Context, plaintext io.Reader, tempFile io.ReadWriteSeeker, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+	GetGroupInfo(jid types.JID) (*types.GroupInfo, error)
+	SetDisappearingTimer(chat types.JID, timer time.Duration) error
+}
+
+var _ messenger = (*whatsappclient.Client)(nil)
+
+// connectMessenger connects the client the send commands use. Tests replace
+// it with a fake.
+var connectMessenger = func() (messenger, error) {
+	client, err := connectClient()
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
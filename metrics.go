@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// listenerMetrics tracks the listener's Prometheus metrics.
+type listenerMetrics struct {
+	registry        *prometheus.Registry
+	messages        *prometheus.CounterVec
+	reconnects      prometheus.Counter
+	decryptFailures prometheus.Counter
+	connected       prometheus.Gauge
+
+	lock         sync.Mutex
+	hasConnected bool
+}
+
+func newListenerMetrics() *listenerMetrics {
+	m := &listenerMetrics{
+		registry: prometheus.NewRegistry(),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "whatsapp_messages_received_total",
+			Help: "Messages received, by message type.",
+		}, []string{"type"}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "whatsapp_reconnects_total",
+			Help: "Times the connection was re-established after the first connect.",
+		}),
+		decryptFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "whatsapp_decryption_failures_total",
+			Help: "Messages that could not be decrypted.",
+		}),
+		connected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "whatsapp_connected",
+			Help: "1 while connected to WhatsApp, 0 otherwise.",
+		}),
+	}
+	m.registry.MustRegister(m.messages, m.reconnects, m.decryptFailures, m.connected)
+	return m
+}
+
+// handleEvent is registered as a client event handler to update metrics.
+func (m *listenerMetrics) handleEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Message:
+		msgType, _ := whatsappclient.ExtractContent(v.Message)
+		m.messages.WithLabelValues(msgType).Inc()
+	case *events.UndecryptableMessage:
+		m.decryptFailures.Inc()
+	case *events.Connected:
+		m.lock.Lock()
+		if m.hasConnected {
+			m.reconnects.Inc()
+		}
+		m.hasConnected = true
+		m.lock.Unlock()
+		m.connected.Set(1)
+	case *events.Disconnected, *events.StreamReplaced, *events.LoggedOut, *events.KeepAliveTimeout:
+		m.connected.Set(0)
+	case *events.KeepAliveRestored:
+		m.connected.Set(1)
+	}
+}
+
+// serve starts the metrics HTTP server on addr. The listener is bound before
+// returning so address errors are reported immediately.
+func (m *listenerMetrics) serve(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{Handler: mux}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Metrics server error: %v\n", err)
+		}
+	}()
+
+	return srv, nil
+}
+
+// shutdownServer stops an HTTP server started alongside the listener.
+func shutdownServer(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// ANSI escape sequences for the listener's coloured output.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+)
+
+// paint wraps text in an ANSI style, if there is one.
+func paint(style, text string) string {
+	if style == "" {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// chatColors are the foreground colours chats are told apart by: the normal
+// and bright variants of every colour except black and white, which
+// disappear on one terminal theme or the other.
+var chatColors = []int{31, 32, 33, 34, 35, 36, 91, 92, 93, 94, 95, 96}
+
+// chatColor picks a colour by hashing the chat's JID, so a chat keeps the
+// same colour across messages and runs.
+func chatColor(chat types.JID) string {
+	h := fnv.New32a()
+	h.Write([]byte(chat.String()))
+	return fmt.Sprintf("\x1b[%dm", chatColors[h.Sum32()%uint32(len(chatColors))])
+}
+
+// senderLabel names the sender, marking messages sent from one of our own
+// devices so the direction of each message is clear. Senders without a
+// push name are shown by their JID in --jid-format.
+func senderLabel(msg whatsappclient.Event) string {
+	if !msg.IsFromMe {
+		if msg.SenderName == "" {
+			return formatJID(msg.Sender)
+		}
+		return msg.SenderName
+	}
+	// Device 0 is the primary phone; linked devices are numbered from 1
+	if msg.Sender.Device == 0 {
+		return "me (via phone)"
+	}
+	return fmt.Sprintf("me (via device %d)", msg.Sender.Device)
+}
+
+// redactEvent masks msg's content, media captions and file names included,
+// for output that may be shared. The metadata is left as it is.
+func redactEvent(msg whatsappclient.Event) whatsappclient.Event {
+	msg.Content = fmt.Sprintf("[REDACTED len=%d]", utf8.RuneCountInString(msg.Content))
+	return msg
+}
+
+// messageSink is where received messages go: stdout, the --output file and
+// the message store. The listener and pull share it.
+type messageSink struct {
+	store  *messageStore
+	output *outputFile
+	// stdout and file format messages for the terminal and the output
+	// file, which never gets colours
+	stdout, file formatter
+	header       sync.Once
+	// redact masks message content in what is printed and written to the
+	// output file, not in the store
+	redact bool
+}
+
+// openMessageSink opens the message store in client's database if
+// storeMessages is set, and the output file if outputPath is given.
+func openMessageSink(client *whatsappclient.Client, storeMessages bool, outputPath string, stdout, file formatter) (*messageSink, error) {
+	sink := &messageSink{stdout: stdout, file: file}
+	var err error
+	if storeMessages {
+		if sink.store, err = openMessageStore(messageStorePath(client.DBPath)); err != nil {
+			return nil, err
+		}
+	}
+	if outputPath != "" {
+		if sink.output, err = openOutputFile(outputPath); err != nil {
+			sink.Close()
+			return nil, err
+		}
+		// Appending to an earlier file keeps the header it already has
+		if h, ok := file.(headerFormatter); ok && sink.output.empty() {
+			if err := sink.output.Write(h.Header()); err != nil {
+				sink.Close()
+				return nil, fmt.Errorf("failed to write output file: %v", err)
+			}
+		}
+	}
+	return sink, nil
+}
+
+// record stores msg and prints it. Failures are printed, since the message
+// has been received either way.
+func (s *messageSink) record(msg whatsappclient.Event) {
+	if s.store != nil {
+		if err := s.store.Save(msg); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+
+	if s.redact {
+		msg = redactEvent(msg)
+	}
+
+	// The header waits for the first message so it follows the startup
+	// output
+	s.header.Do(func() {
+		if h, ok := s.stdout.(headerFormatter); ok {
+			fmt.Print(h.Header())
+		}
+	})
+	fmt.Print(s.stdout.Format(msg))
+	if s.output != nil {
+		if err := s.output.Write(s.file.Format(msg)); err != nil {
+			fmt.Printf("Error writing output file: %v\n", err)
+		}
+	}
+}
+
+// applyDeletion removes messages deleted on another device from the store.
+func (s *messageSink) applyDeletion(evt interface{}) {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.applyDeletion(evt); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
+
+func (s *messageSink) Close() error {
+	if s.output != nil {
+		s.output.Close()
+	}
+	if s.store != nil {
+		return s.store.Close()
+	}
+	return nil
+}
+
+// outputFile is an append-only copy of the listener's message output. It is
+// reopened on SIGHUP so logrotate can move the file away underneath it.
+type outputFile struct {
+	path string
+	lock sync.Mutex
+	file *os.File
+}
+
+func openOutputFile(path string) (*outputFile, error) {
+	o := &outputFile{path: path}
+	if err := o.reopen(); err != nil {
+		return nil, err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := o.reopen(); err != nil {
+				fmt.Printf("Error reopening output file: %v\n", err)
+			}
+		}
+	}()
+
+	return o, nil
+}
+
+func (o *outputFile) reopen() error {
+	f, err := os.OpenFile(o.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %v", err)
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file = f
+	return nil
+}
+
+// empty reports whether nothing has been written to the file yet, by this
+// run or an earlier one.
+func (o *outputFile) empty() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	info, err := o.file.Stat()
+	return err == nil && info.Size() == 0
+}
+
+// Write appends text and syncs it to disk so each message is durable.
+func (o *outputFile) Write(text string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if _, err := o.file.WriteString(text); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+func (o *outputFile) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.file.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// maxPollOptions is the most options WhatsApp allows in a poll.
+const maxPollOptions = 12
+
+// validatePoll checks the question and options before connecting. Votes
+// refer to options by a hash of their text, so options must be distinct.
+func validatePoll(question string, options []string) error {
+	if strings.TrimSpace(question) == "" {
+		return fmt.Errorf("the poll question is empty")
+	}
+	if len(options) < 2 || len(options) > maxPollOptions {
+		return fmt.Errorf("a poll needs 2 to %d options, got %d", maxPollOptions, len(options))
+	}
+	seen := make(map[string]bool, len(options))
+	for _, option := range options {
+		if strings.TrimSpace(option) == "" {
+			return fmt.Errorf("poll options must not be empty")
+		}
+		if seen[option] {
+			return fmt.Errorf("poll option %q is given twice", option)
+		}
+		seen[option] = true
+	}
+	return nil
+}
+
+func sendPoll(ctx context.Context, args []string) error {
+	fs := newFlagSet("send-poll")
+	multi := fs.Bool("multi", false, "let voters pick more than one option")
+	args = parseCommandFlags(fs, args)
+
+	if len(args) < 4 {
+		fmt.Println("Usage: send-poll <recipient> <question> <option> <option> [option...] [--multi]")
+		return errUsage
+	}
+	recipient, question, options := args[0], args[1], args[2:]
+
+	if err := whatsappclient.ValidateRecipient(recipient); err != nil {
+		return err
+	}
+	if err := validatePoll(question, options); err != nil {
+		return err
+	}
+
+	// 0 lets voters select any number of options
+	selectable := 1
+	if *multi {
+		selectable = 0
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	// The poll carries a random secret that votes are encrypted with;
+	// SendMessage keeps it in the session database so votes can be
+	// decrypted later
+	msg := client.BuildPollCreation(question, options, selectable)
+	return sendAndReport(ctx, client, recipient, msg, "poll")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// privacyKey is a privacy setting as named on the command line, with the
+// values WhatsApp accepts for it.
+type privacyKey struct {
+	name    string
+	label   string
+	setting types.PrivacySettingType
+	values  []types.PrivacySetting
+	get     func(types.PrivacySettings) types.PrivacySetting
+}
+
+// privacyKeys are listed in the order the phone app shows them.
+var privacyKeys = []privacyKey{
+	{"last-seen", "Last seen", types.PrivacySettingTypeLastSeen,
+		[]types.PrivacySetting{types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone},
+		func(s types.PrivacySettings) types.PrivacySetting { return s.LastSeen }},
+	{"online", "Online", types.PrivacySettingTypeOnline,
+		[]types.PrivacySetting{types.PrivacySettingAll, types.PrivacySettingMatchLastSeen},
+		func(s types.PrivacySettings) types.PrivacySetting { return s.Online }},
+	{"profile-photo", "Profile photo", types.PrivacySettingTypeProfile,
+		[]types.PrivacySetting{types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone},
+		func(s types.PrivacySettings) types.PrivacySetting { return s.Profile }},
+	{"about", "About", types.PrivacySettingTypeStatus,
+		[]types.PrivacySetting{types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone},
+		func(s types.PrivacySettings) types.PrivacySetting { return s.Status }},
+	{"groups", "Groups", types.PrivacySettingTypeGroupAdd,
+		[]types.PrivacySetting{types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone},
+		func(s types.PrivacySettings) types.PrivacySetting { return s.GroupAdd }},
+	{"read-receipts", "Read receipts", types.PrivacySettingTypeReadReceipts,
+		[]types.PrivacySetting{types.PrivacySettingAll, types.PrivacySettingNone},
+		func(s types.PrivacySettings) types.PrivacySetting { return s.ReadReceipts }},
+	{"calls", "Calls", types.PrivacySettingTypeCallAdd,
+		[]types.PrivacySetting{types.PrivacySettingAll, types.PrivacySettingKnown},
+		func(s types.PrivacySettings) types.PrivacySetting { return s.CallAdd }},
+}
+
+func findPrivacyKey(name string) (privacyKey, error) {
+	var names []string
+	for _, k := range privacyKeys {
+		if k.name == name {
+			return k, nil
+		}
+		names = append(names, k.name)
+	}
+	return privacyKey{}, fmt.Errorf("unknown privacy setting %q (want one of %s)", name, strings.Join(names, ", "))
+}
+
+// parseValue checks value against the values WhatsApp accepts for k. The
+// whatsmeow names are used as is, e.g. contact_blacklist for "my contacts
+// except...".
+func (k privacyKey) parseValue(value string) (types.PrivacySetting, error) {
+	v := types.PrivacySetting(value)
+	if slices.Contains(k.values, v) {
+		return v, nil
+	}
+	names := make([]string, len(k.values))
+	for i, allowed := range k.values {
+		names[i] = string(allowed)
+	}
+	return "", fmt.Errorf("invalid value %q for %s (want one of %s)", value, k.name, strings.Join(names, ", "))
+}
+
+func printPrivacySettings(settings types.PrivacySettings) {
+	fmt.Println("Privacy settings:")
+	for _, k := range privacyKeys {
+		value := string(k.get(settings))
+		if value == "" {
+			value = "(unknown)"
+		}
+		fmt.Printf("  %-30s %s\n", k.label+" ("+k.name+"):", value)
+	}
+}
+
+// privacySettings implements "privacy" and "privacy set <key> <value>".
+func privacySettings(args []string) error {
+	args = parseCommandFlags(newFlagSet("privacy"), args)
+
+	var key privacyKey
+	var value types.PrivacySetting
+	switch {
+	case len(args) == 0:
+	case len(args) == 3 && args[0] == "set":
+		var err error
+		if key, err = findPrivacyKey(args[1]); err != nil {
+			return err
+		}
+		if value, err = key.parseValue(args[2]); err != nil {
+			return err
+		}
+	default:
+		fmt.Println("Usage: privacy | privacy set <setting> <value>")
+		return errUsage
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if key.name == "" {
+		settings, err := client.TryFetchPrivacySettings(true)
+		if err != nil {
+			return fmt.Errorf("failed to get privacy settings: %v", err)
+		}
+		printPrivacySettings(*settings)
+		return nil
+	}
+
+	settings, err := client.SetPrivacySetting(key.setting, value)
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %v", key.name, err)
+	}
+	fmt.Printf("Set %s to %s\n", key.name, value)
+	printPrivacySettings(settings)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// pullMessages connects, prints and stores the messages queued while
+// offline, and disconnects once WhatsApp reports the backlog delivered, for
+// polling from cron instead of running the listener all the time. Messages
+// are acknowledged as they arrive, so the next pull only gets newer ones.
+func pullMessages(ctx context.Context, args []string) error {
+	fs := newFlagSet("pull")
+	storeMessages := fs.Bool("store-messages", false, "record the pulled messages in the local database")
+	outputPath := fs.String("output", "", "also append each message to this file")
+	redact := fs.Bool("redact", false, "mask message text, captions and file names in printed output and --output, keeping the metadata")
+	idleTimeout := fs.Duration("idle-timeout", 10*time.Second, "stop after this long without a message if WhatsApp never reports the backlog done")
+	var format formatOptions
+	format.register(fs, "text")
+	registerJIDFormat(fs)
+	storePath := bindSetting(fs, messagesDBSetting)
+	parseCommandFlags(fs, args, storePath)
+
+	if *idleTimeout <= 0 {
+		return fmt.Errorf("--idle-timeout must be positive")
+	}
+	stdoutFormat, fileFormat, err := format.build(fs)
+	if err != nil {
+		return err
+	}
+	if err := validateJIDFormat(); err != nil {
+		return err
+	}
+
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to set up client: %v", err)
+	}
+	defer client.Close()
+	applyJIDFormat(client.Store.Contacts)
+
+	sink, err := openMessageSink(client, *storeMessages, *outputPath, stdoutFormat, fileFormat)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	sink.redact = *redact
+
+	var pulled atomic.Int64
+	activity := make(chan struct{}, 1)
+	drained := make(chan int, 1)
+	client.AddEventHandler(func(evt interface{}) {
+		if handleConnectionFailure(evt) {
+			return
+		}
+		switch v := evt.(type) {
+		case *events.Message:
+			pulled.Add(1)
+			sink.record(whatsappclient.NewEvent(v))
+			select {
+			case activity <- struct{}{}:
+			default:
+			}
+		case *events.DeleteForMe, *events.ClearChat, *events.DeleteChat:
+			sink.applyDeletion(v)
+		case *events.OfflineSyncCompleted:
+			select {
+			case drained <- v.Count:
+			default:
+			}
+		}
+	})
+
+	if err := connectAndWait(client); err != nil {
+		return err
+	}
+
+	idle := time.NewTimer(*idleTimeout)
+	defer idle.Stop()
+	for done := false; !done; {
+		select {
+		case <-drained:
+			done = true
+		case <-activity:
+			idle.Reset(*idleTimeout)
+		case <-idle.C:
+			done = true
+		case <-ctx.Done():
+			fmt.Println("\nInterrupted before the backlog was pulled")
+			return nil
+		}
+	}
+
+	if err := client.SaveStore(); err != nil {
+		fmt.Printf("Error saving to database: %v\n", err)
+	}
+	fmt.Printf("Pulled %d messages\n", pulled.Load())
+	return nil
+}
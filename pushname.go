@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/appstate"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// setPushName changes the account's push name with an app-state patch and
+// checks that the stored name was updated. SendAppState re-fetches the
+// patched collection, which is what writes the new name to the store.
+func setPushName(client *whatsappclient.Client, name string) error {
+	if err := client.SendAppState(appstate.BuildSettingPushName(name)); err != nil {
+		return fmt.Errorf("failed to update push name: %v", err)
+	}
+
+	if client.Store.PushName != name {
+		return fmt.Errorf("push name was sent but the store still has %q", client.Store.PushName)
+	}
+	return nil
+}
+
+func setName(args []string) error {
+	args = parseCommandFlags(newFlagSet("set-name"), args)
+
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		fmt.Println("Usage: set-name <name>")
+		return errUsage
+	}
+	name := strings.TrimSpace(args[0])
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	fmt.Printf("Current push name: %q\n", client.Store.PushName)
+	if err := setPushName(client, name); err != nil {
+		return err
+	}
+
+	fmt.Printf("Push name is now: %q\n", client.Store.PushName)
+	return nil
+}
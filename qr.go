@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// loginDone is the payload written to --login-done-file once login completes.
+type loginDone struct {
+	JID       string    `json:"jid"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func writeLoginDoneFile(path string, jid string) error {
+	data, err := json.MarshalIndent(loginDone{JID: jid, Timestamp: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename so a watcher never sees a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// lastLoginPath is the state file recording the most recent qr login for
+// the database at dbPath.
+func lastLoginPath(dbPath string) string {
+	return dbPath + ".last-login.json"
+}
+
+// readLastLogin returns the JID of the most recent qr login for dbPath, or
+// "" if there is none.
+func readLastLogin(dbPath string) string {
+	data, err := os.ReadFile(lastLoginPath(dbPath))
+	if err != nil {
+		return ""
+	}
+	var last loginDone
+	if err := json.Unmarshal(data, &last); err != nil {
+		return ""
+	}
+	return last.JID
+}
+
+// startQRCountdown prints the remaining validity of the current QR code on a
+// single updating line until the returned stop function is called.
+func startQRCountdown(timeout time.Duration) func() {
+	expires := time.Now().Add(timeout)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			remaining := time.Until(expires).Round(time.Second)
+			if remaining < 0 {
+				remaining = 0
+			}
+			fmt.Printf("\rCode valid for %3ds ", int(remaining.Seconds()))
+			select {
+			case <-done:
+				fmt.Println()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
+
+// errTooManyQRAttempts is returned when --max-attempts codes expire unscanned.
+var errTooManyQRAttempts = errors.New("no QR code was scanned")
+
+// pairDevice shows QR codes until one is scanned and returns the logged-in
+// JID. The client is left connected.
+func pairDevice(ctx context.Context, client *whatsappclient.Client, render qrRenderOptions, maxAttempts int) (types.JID, error) {
+	attempts := 0
+	stopCountdown := func() {}
+	defer func() { stopCountdown() }()
+
+	fmt.Println("Waiting for QR code...")
+	return client.Login(ctx, whatsappclient.LoginOptions{
+		OnCode: func(code string, timeout time.Duration) error {
+			stopCountdown()
+
+			attempts++
+			if maxAttempts > 0 && attempts > maxAttempts {
+				return fmt.Errorf("%w after %d attempts", errTooManyQRAttempts, maxAttempts)
+			}
+
+			qr, err := qrcode.New(code, render.level)
+			if err != nil {
+				fmt.Printf("Failed to generate QR code: %v\n", err)
+				return nil
+			}
+
+			fmt.Printf("Scan this QR code in WhatsApp (attempt %d", attempts)
+			if maxAttempts > 0 {
+				fmt.Printf(" of %d", maxAttempts)
+			}
+			fmt.Println("):")
+			fmt.Println(render.render(qr))
+			if render.png != "" {
+				if err := qr.WriteFile(render.size, render.png); err != nil {
+					fmt.Printf("Failed to save QR code image: %v\n", err)
+				} else {
+					fmt.Printf("QR code also saved to %s\n", render.png)
+				}
+			}
+			stopCountdown = startQRCountdown(timeout)
+			return nil
+		},
+		OnScanned: func() {
+			stopCountdown()
+			fmt.Println("QR code scanned successfully!")
+			fmt.Println("Waiting for full login to complete...")
+		},
+	})
+}
+
+// waitForInitialSync keeps the new session connected while the phone sends
+// the initial history and app state, until ctx is cancelled.
+func waitForInitialSync(ctx context.Context, client *whatsappclient.Client) {
+	fmt.Println("\nStarting initial sync...")
+	fmt.Println("Please wait for the sync to complete (this may take a few minutes)")
+	fmt.Println("You should see your WhatsApp contacts and chats appear on your phone")
+	fmt.Println("Press Ctrl+C when the sync is complete")
+
+	<-ctx.Done()
+
+	fmt.Println("\nDisconnecting safely...")
+
+	// Force final save before disconnecting
+	if err := client.SaveStore(); err != nil {
+		fmt.Printf("Error saving final state to database: %v\n", err)
+	}
+
+	client.Disconnect()
+}
+
+// pushNameSyncTimeout bounds how long qr --push-name waits for the phone to
+// share the app-state keys the push name patch is encrypted with.
+const pushNameSyncTimeout = 2 * time.Minute
+
+// setPushNameAfterLogin sets the push name of a new session. A patch can
+// only be sent once the phone has shared the app-state keys, which arrive
+// with the critical_block sync; that sync also carries the phone's current
+// name, so waiting for it keeps it from overwriting the new one.
+func setPushNameAfterLogin(ctx context.Context, client *whatsappclient.Client, name string, criticalSynced <-chan struct{}) error {
+	fmt.Printf("Waiting for the app-state sync to set the push name to %q...\n", name)
+	select {
+	case <-criticalSynced:
+	case <-time.After(pushNameSyncTimeout):
+		return fmt.Errorf("app-state keys were not received within %s", pushNameSyncTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := setPushName(client, name); err != nil {
+		return err
+	}
+	fmt.Printf("Push name is now: %q\n", client.Store.PushName)
+	return nil
+}
+
+// verifyLogin reopens the database to check the session of jid was saved.
+func verifyLogin(jid types.JID) error {
+	clientOptions.NewDevice, clientOptions.SessionJID = false, jid.String()
+	verifyClient, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to verify credentials: %v", err)
+	}
+
+	if !verifyClient.Registered {
+		return fmt.Errorf("device ID was not properly saved to database")
+	}
+
+	fmt.Printf("Verification successful! Device ID: %s\n", verifyClient.Store.ID.String())
+	return nil
+}
+
+// errLoggedOutDuringQR ends qr when the new device is unlinked from the
+// phone before the flow finishes.
+var errLoggedOutDuringQR = withExitCode(exitNotLoggedIn, errors.New("device was logged out from the phone"))
+
+// eventRegistrar is what qrEvents registers its handler with: the client, or
+// a fake that counts handlers.
+type eventRegistrar interface {
+	AddEventHandler(handler whatsmeow.EventHandler) uint32
+	RemoveEventHandler(id uint32) bool
+}
+
+// qrEvents handles the client events of the qr flow. An event that ends
+// the flow cancels its context and records the error for generateQR to
+// return, so the client is closed and its lock file released as after any
+// other command.
+type qrEvents struct {
+	ctx            context.Context
+	cancel         context.CancelFunc
+	client         *whatsappclient.Client
+	streamReplaced streamReplacedPolicy
+
+	// criticalSynced is closed once the critical_block app state has synced
+	criticalSynced chan struct{}
+	criticalOnce   sync.Once
+
+	lock    sync.Mutex
+	exitErr error
+}
+
+func newQREvents(ctx context.Context, cancel context.CancelFunc, client *whatsappclient.Client, streamReplaced streamReplacedPolicy) *qrEvents {
+	return &qrEvents{
+		ctx:            ctx,
+		cancel:         cancel,
+		client:         client,
+		streamReplaced: streamReplaced,
+		criticalSynced: make(chan struct{}),
+	}
+}
+
+// register adds the handler to r and returns the function removing it.
+func (e *qrEvents) register(r eventRegistrar) func() {
+	id := r.AddEventHandler(e.handleEvent)
+	return func() { r.RemoveEventHandler(id) }
+}
+
+func (e *qrEvents) handleEvent(evt interface{}) {
+	if handleConnectionFailure(evt) {
+		return
+	}
+
+	switch v := evt.(type) {
+	case *events.Connected:
+		fmt.Println("Connected to WhatsApp!")
+	case *events.StreamReplaced:
+		if e.streamReplaced.handle(e.ctx, e.client) {
+			fmt.Println("Connection replaced by another login")
+			e.stop(errStreamReplaced)
+		}
+	case *events.LoggedOut:
+		fmt.Println("Device logged out!")
+		e.stop(errLoggedOutDuringQR)
+	case *events.PushNameSetting:
+		fmt.Printf("Push name changed to %q\n", v.Action.GetName())
+	case *events.AppStateSyncComplete:
+		fmt.Printf("Sync completed for %s\n", v.Name)
+		if v.Name == appstate.WAPatchCriticalBlock {
+			e.criticalOnce.Do(func() { close(e.criticalSynced) })
+		}
+	}
+}
+
+// stop ends the flow with err, keeping the first error if called again.
+func (e *qrEvents) stop(err error) {
+	e.lock.Lock()
+	if e.exitErr == nil {
+		e.exitErr = err
+	}
+	e.lock.Unlock()
+	e.cancel()
+}
+
+// err is the error an event ended the flow with, if any.
+func (e *qrEvents) err() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.exitErr
+}
+
+func generateQR(ctx context.Context, args []string) error {
+	fs := newFlagSet("qr")
+	loginDoneFile := fs.String("login-done-file", "", "write a JSON file with the logged-in JID and timestamp once login completes")
+	maxAttempts := fs.Int("max-attempts", 0, "exit with an error after this many QR codes expire without a scan (0 = no limit)")
+	exitOnLogin := fs.Bool("exit-on-login", false, "exit as soon as login completes instead of staying connected for the initial sync")
+	pushName := fs.String("push-name", "", "set the account's push name, the name recipients see, once login completes")
+	fs.StringVar(&clientOptions.DeviceName, "device-name", "", "name shown for this device in the phone's linked-devices list")
+	fs.StringVar(&clientOptions.DevicePlatform, "device-platform", "", "platform icon for the linked device (e.g. chrome, firefox, safari, edge, desktop)")
+	var render qrRenderOptions
+	render.register(fs)
+	var streamReplaced streamReplacedPolicy
+	streamReplaced.register(fs)
+	parseCommandFlags(fs, args)
+
+	if err := render.validate(); err != nil {
+		return err
+	}
+	if err := streamReplaced.validate(); err != nil {
+		return err
+	}
+	pushNameSet := false
+	fs.Visit(func(f *flag.Flag) {
+		pushNameSet = pushNameSet || f.Name == "push-name"
+	})
+	*pushName = strings.TrimSpace(*pushName)
+	if pushNameSet && *pushName == "" {
+		return fmt.Errorf("--push-name must not be empty")
+	}
+
+	// Without a platform the phone shows a generic icon, so pick one that
+	// matches a custom name
+	if clientOptions.DeviceName != "" && clientOptions.DevicePlatform == "" {
+		clientOptions.DevicePlatform = "DESKTOP"
+	}
+
+	// Remove any result from a previous login attempt
+	if *loginDoneFile != "" {
+		if err := os.Remove(*loginDoneFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old login done file: %v", err)
+		}
+	}
+
+	// Without --session, log in as a new device, keeping any accounts
+	// already stored; the new one becomes the default for later commands
+	clientOptions.NewDevice = clientOptions.SessionJID == ""
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to set up client: %v", err)
+	}
+
+	if client.Registered {
+		fmt.Printf("Already logged in as %s (%s).\n", client.Store.ID.String(), client.DBPath)
+		fmt.Println("Use 'go run . message' to listen for messages, or run qr without --session to log in another account.")
+		return nil
+	}
+	if sessions, err := client.Sessions(); err == nil && len(sessions) > 0 {
+		fmt.Printf("Adding a new login beside the %d %s in %s\n", len(sessions), plural(len(sessions), "session", "sessions"), client.DBPath)
+	}
+
+	// A single handler covers the whole flow, including the sync progress
+	// after login, and is removed when generateQR returns
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	qrEvents := newQREvents(ctx, cancel, client, streamReplaced)
+	defer qrEvents.register(client)()
+
+	jid, err := pairDevice(ctx, client, render, *maxAttempts)
+	if err != nil && qrEvents.err() != nil {
+		return qrEvents.err()
+	} else if errors.Is(err, errTooManyQRAttempts) {
+		return err
+	} else if err != nil && ctx.Err() != nil {
+		fmt.Println("\nInterrupted before login completed")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("QR code scanning was not completed successfully: %v", err)
+	}
+
+	fmt.Printf("Successfully logged in as %s\n", jid.String())
+
+	// Later commands use this session by default when no --session is given
+	if err := writeLoginDoneFile(lastLoginPath(client.DBPath), jid.String()); err != nil {
+		fmt.Printf("Error recording last login: %v\n", err)
+	}
+
+	if *loginDoneFile != "" {
+		if err := writeLoginDoneFile(*loginDoneFile, jid.String()); err != nil {
+			fmt.Printf("Error writing login done file: %v\n", err)
+		} else {
+			fmt.Printf("Login result written to %s\n", *loginDoneFile)
+		}
+	}
+
+	if *pushName != "" {
+		if err := setPushNameAfterLogin(ctx, client, *pushName, qrEvents.criticalSynced); err != nil {
+			if qrEvents.err() != nil {
+				return qrEvents.err()
+			}
+			err = fmt.Errorf("%v; set it later with 'go run . set-name'", err)
+			if *exitOnLogin {
+				client.Disconnect()
+				return err
+			}
+			fmt.Printf("Error setting push name: %v\n", err)
+		}
+	}
+
+	if *exitOnLogin {
+		client.Disconnect()
+		return nil
+	}
+
+	waitForInitialSync(ctx, client)
+	if err := qrEvents.err(); err != nil {
+		return err
+	}
+
+	if err := verifyLogin(jid); err != nil {
+		return err
+	}
+	fmt.Println("\nYou can now use 'go run . message' to listen for messages")
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// countingRegistrar keeps the registered handlers so a test can count and
+// call them.
+type countingRegistrar struct {
+	next     uint32
+	handlers map[uint32]whatsmeow.EventHandler
+}
+
+func (r *countingRegistrar) AddEventHandler(handler whatsmeow.EventHandler) uint32 {
+	if r.handlers == nil {
+		r.handlers = make(map[uint32]whatsmeow.EventHandler)
+	}
+	r.next++
+	r.handlers[r.next] = handler
+	return r.next
+}
+
+func (r *countingRegistrar) RemoveEventHandler(id uint32) bool {
+	_, ok := r.handlers[id]
+	delete(r.handlers, id)
+	return ok
+}
+
+func (r *countingRegistrar) dispatch(evt interface{}) {
+	for _, handler := range r.handlers {
+		handler(evt)
+	}
+}
+
+func TestQREventsSingleHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []interface{}
+		wantErr  error
+		wantCode int
+	}{
+		{name: "login cycle", events: []interface{}{
+			&events.Connected{}, &events.AppStateSyncComplete{Name: appstate.WAPatchCriticalBlock}, &events.Connected{},
+		}},
+		{name: "logged out", events: []interface{}{&events.Connected{}, &events.LoggedOut{}},
+			wantErr: errLoggedOutDuringQR, wantCode: exitNotLoggedIn},
+		{name: "stream replaced", events: []interface{}{&events.Connected{}, &events.StreamReplaced{}, &events.LoggedOut{}},
+			wantErr: errStreamReplaced, wantCode: exitConnectFailure},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		qrEvents := newQREvents(ctx, cancel, nil, streamReplacedPolicy{value: "exit"})
+		registrar := &countingRegistrar{}
+
+		remove := qrEvents.register(registrar)
+		if len(registrar.handlers) != 1 {
+			t.Errorf("%s: %d handlers registered, want 1", tt.name, len(registrar.handlers))
+		}
+		for _, evt := range tt.events {
+			registrar.dispatch(evt)
+			if len(registrar.handlers) != 1 {
+				t.Errorf("%s: %d handlers registered after %T, want 1", tt.name, len(registrar.handlers), evt)
+			}
+		}
+		remove()
+		if len(registrar.handlers) != 0 {
+			t.Errorf("%s: %d handlers left after the flow, want 0", tt.name, len(registrar.handlers))
+		}
+
+		if !errors.Is(qrEvents.err(), tt.wantErr) {
+			t.Errorf("%s: flow ended with %v, want %v", tt.name, qrEvents.err(), tt.wantErr)
+		}
+		if tt.wantErr != nil {
+			if ctx.Err() == nil {
+				t.Errorf("%s: context not cancelled", tt.name)
+			}
+			if code := exitCodeFor(qrEvents.err()); code != tt.wantCode {
+				t.Errorf("%s: exit code %d, want %d", tt.name, code, tt.wantCode)
+			}
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// ansiColors maps the colour names accepted by --foreground-color and
+// --background-color to ANSI foreground codes; background codes are 10 higher.
+var ansiColors = map[string]int{
+	"black":   30,
+	"red":     31,
+	"green":   32,
+	"yellow":  33,
+	"blue":    34,
+	"magenta": 35,
+	"cyan":    36,
+	"white":   97,
+}
+
+// QR rendering modes for --qr-mode.
+const (
+	qrModeAuto = "auto"
+	qrModeANSI = "ansi"
+	qrModeText = "text"
+)
+
+// qrLevels maps --qr-ec to error-correction levels. Higher levels survive
+// more blur and glare but make denser codes.
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// qrRenderOptions controls how login QR codes are drawn in the terminal and
+// saved as images.
+type qrRenderOptions struct {
+	mode       string
+	invert     bool
+	foreground string
+	background string
+	ec         string
+	level      qrcode.RecoveryLevel
+	png        string
+	size       int
+}
+
+func (o *qrRenderOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.mode, "qr-mode", qrModeAuto, "QR rendering: ansi (explicit colours), text (plain block characters) or auto")
+	fs.BoolVar(&o.invert, "qr-invert", false, "swap dark and light QR modules")
+	fs.StringVar(&o.foreground, "foreground-color", "black", "colour of dark QR modules in ansi mode")
+	fs.StringVar(&o.background, "background-color", "white", "colour of light QR modules in ansi mode")
+	fs.StringVar(&o.ec, "qr-ec", "M", "QR error correction: L, M, Q or H (higher scans better from a blurry screen)")
+	fs.StringVar(&o.png, "qr-png", "", "also save each QR code as a PNG image at this path")
+	fs.IntVar(&o.size, "qr-size", 256, "width and height of the --qr-png image in pixels")
+}
+
+// validate checks the QR flags and resolves the auto mode.
+func (o *qrRenderOptions) validate() error {
+	switch o.mode {
+	case qrModeAuto:
+		o.mode = detectQRMode()
+	case qrModeANSI, qrModeText:
+	default:
+		return fmt.Errorf("invalid --qr-mode %q: must be auto, ansi or text", o.mode)
+	}
+	level, ok := qrLevels[strings.ToUpper(o.ec)]
+	if !ok {
+		return fmt.Errorf("invalid --qr-ec %q: must be L, M, Q or H", o.ec)
+	}
+	o.level = level
+	if o.size <= 0 {
+		return fmt.Errorf("--qr-size must be positive")
+	}
+	for _, c := range []string{o.foreground, o.background} {
+		if _, ok := ansiColors[c]; !ok {
+			return fmt.Errorf("unknown colour %q (use black, red, green, yellow, blue, magenta, cyan or white)", c)
+		}
+	}
+	if o.foreground == o.background {
+		return fmt.Errorf("--foreground-color and --background-color must differ")
+	}
+	return nil
+}
+
+// detectQRMode uses ANSI colours when stdout supports them, so the code
+// doesn't depend on the terminal theme.
+func detectQRMode() string {
+	if !stdoutHasColor() {
+		return qrModeText
+	}
+	return qrModeANSI
+}
+
+// stdoutHasColor reports whether stdout is a terminal that isn't known to
+// lack colour support.
+func stdoutHasColor() bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// render draws qr for the terminal.
+func (o qrRenderOptions) render(qr *qrcode.QRCode) string {
+	if o.mode != qrModeANSI {
+		return strings.TrimSpace(qr.ToSmallString(o.invert))
+	}
+
+	dark, light := ansiColors[o.foreground], ansiColors[o.background]
+	if o.invert {
+		dark, light = light, dark
+	}
+	color := func(module bool) int {
+		if module {
+			return dark
+		}
+		return light
+	}
+
+	// Each line holds two rows of modules: the upper half block takes the
+	// top module's colour as foreground and the bottom one's as background
+	bitmap := qr.Bitmap()
+	var b strings.Builder
+	for y := 0; y < len(bitmap); y += 2 {
+		for x := range bitmap[y] {
+			bottom := false
+			if y+1 < len(bitmap) {
+				bottom = bitmap[y+1][x]
+			}
+			fmt.Fprintf(&b, "\x1b[%d;%dm▀", color(bitmap[y][x]), color(bottom)+10)
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
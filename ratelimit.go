@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+const (
+	// rateLimitCooldown is the first pause after WhatsApp rate-limits a
+	// send. It doubles for each consecutive rate limit, up to
+	// maxRateLimitCooldown, since pushing on through a soft limit is how
+	// accounts end up temporarily banned.
+	rateLimitCooldown    = time.Minute
+	maxRateLimitCooldown = 15 * time.Minute
+)
+
+// isRateLimited reports whether err is WhatsApp refusing a request for
+// being over its rate limit (HTTP-style status 429), whether from an info
+// query, a message send or a media upload.
+func isRateLimited(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, whatsmeow.ErrIQRateOverLimit) {
+		return true
+	}
+	// Send and upload failures only carry the status code in the message
+	msg := err.Error()
+	return (errors.Is(err, whatsmeow.ErrServerReturnedError) && strings.HasSuffix(msg, " 429")) ||
+		strings.Contains(msg, "status code 429")
+}
+
+// rateLimitBackoff pauses every send of a run once WhatsApp starts
+// rate-limiting, not just the one that was refused. The zero value is ready
+// to use.
+type rateLimitBackoff struct {
+	hits  int
+	until time.Time
+}
+
+// hit records a rate-limited send and returns the cooldown that now applies.
+func (b *rateLimitBackoff) hit() time.Duration {
+	cooldown := rateLimitCooldown << min(b.hits, 4)
+	cooldown = min(cooldown, maxRateLimitCooldown)
+	b.hits++
+	b.until = time.Now().Add(cooldown)
+	fmt.Printf("[RateLimit] Rate limited by WhatsApp (%d in a row), pausing sends for %s until %s\n",
+		b.hits, cooldown, b.until.Local().Format("2006-01-02 15:04:05"))
+	return cooldown
+}
+
+// wait blocks until the current cooldown, if any, is over.
+func (b *rateLimitBackoff) wait(ctx context.Context) error {
+	remaining := time.Until(b.until)
+	if remaining <= 0 {
+		return nil
+	}
+	fmt.Printf("[RateLimit] Waiting %s before the next send\n", remaining.Round(time.Second))
+	return sleepContext(ctx, remaining)
+}
+
+// reset clears the backoff after a send goes through.
+func (b *rateLimitBackoff) reset() {
+	if b.hits > 0 {
+		fmt.Println("[RateLimit] Sends accepted again, backoff cleared")
+	}
+	b.hits = 0
+	b.until = time.Time{}
+}
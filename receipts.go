@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// receiptStates describes the receipt types worth showing. Played is kept
+// apart from read: it is sent once a voice note, video note or view-once
+// media is actually played, while read only means the chat was opened.
+var receiptStates = map[types.ReceiptType]string{
+	types.ReceiptTypeDelivered:  "delivered to",
+	types.ReceiptTypeRead:       "read by",
+	types.ReceiptTypePlayed:     "played by",
+	types.ReceiptTypeReadSelf:   "read on another of your devices by",
+	types.ReceiptTypePlayedSelf: "played on another of your devices by",
+}
+
+// printReceiptEvent prints delivery, read and played receipts. Internal
+// receipt types (retries, history sync, peer messages) are skipped.
+func printReceiptEvent(evt interface{}) {
+	v, ok := evt.(*events.Receipt)
+	if !ok {
+		return
+	}
+	state, ok := receiptStates[v.Type]
+	if !ok {
+		return
+	}
+
+	chat := ""
+	if v.IsGroup {
+		chat = " in " + formatJID(v.Chat)
+	}
+	fmt.Printf("[Receipt] %s %s %s%s at %s\n", strings.Join(v.MessageIDs, ", "), state, formatJID(v.Sender.ToNonAD()), chat, v.Timestamp.Local().Format("2006-01-02 15:04:05"))
+}
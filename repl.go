@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+func printReplHelp() {
+	fmt.Println("Commands:")
+	fmt.Println("  send <recipient> <text>   Send a text message")
+	fmt.Println("  contacts [search]         List contacts, optionally filtered by name or JID")
+	fmt.Println("  groups [search]           List joined groups, optionally filtered by name or JID")
+	fmt.Println("  help                      Show this help")
+	fmt.Println("  quit                      Disconnect and exit")
+}
+
+// cutField splits off the first whitespace-separated word of s.
+func cutField(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+// runReplCommand runs one line typed at the prompt. It returns false when the
+// session should end.
+func runReplCommand(ctx context.Context, client *whatsappclient.Client, line string) bool {
+	command, rest := cutField(line)
+
+	var err error
+	switch command {
+	case "":
+	case "send":
+		// Keep the message text as typed, spacing included
+		recipient, text := cutField(rest)
+		if recipient == "" || text == "" {
+			fmt.Println("Usage: send <recipient> <text>")
+			return true
+		}
+		msg := &waE2E.Message{Conversation: proto.String(text)}
+		err = sendAndReport(ctx, client, recipient, msg, "message")
+	case "contacts":
+		err = printContacts(client, listOptions{search: rest})
+	case "groups":
+		err = printGroups(client, listOptions{search: rest})
+	case "help":
+		printReplHelp()
+	case "quit", "exit":
+		return false
+	default:
+		fmt.Printf("Unknown command: %s (type 'help' for a list)\n", command)
+	}
+
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	return true
+}
+
+func runRepl(ctx context.Context, args []string) error {
+	fs := newFlagSet("repl")
+	var format formatOptions
+	format.register(fs, "text")
+	parseCommandFlags(fs, args)
+	output, _, err := format.build(fs)
+	if err != nil {
+		return err
+	}
+
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to set up client: %v", err)
+	}
+
+	// Print incoming messages in the background while commands are typed
+	client.AddEventHandler(func(evt interface{}) {
+		if handleConnectionFailure(evt) {
+			return
+		}
+		if v, ok := evt.(*events.Message); ok {
+			fmt.Print("\n" + output.Format(whatsappclient.NewEvent(v)))
+			fmt.Print("> ")
+		}
+	})
+
+	if err := connectAndWait(client); err != nil {
+		return err
+	}
+	defer func() {
+		if err := client.SaveStore(); err != nil {
+			fmt.Printf("Error saving to database: %v\n", err)
+		}
+		client.Disconnect()
+	}()
+
+	fmt.Printf("Connected as %s. Type 'help' for commands.\n", client.Store.ID.String())
+
+	// Read stdin in its own goroutine so Ctrl+C can end the session while the
+	// scanner is blocked waiting for input
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for {
+		fmt.Print("> ")
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				fmt.Println()
+				return nil
+			}
+			if !runReplCommand(ctx, client, line) {
+				return nil
+			}
+		case <-ctx.Done():
+			fmt.Println()
+			return nil
+		}
+	}
+}
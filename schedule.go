@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// schedulePollInterval is how often the listener checks for scheduled
+// messages that are due, so they go out at most this late.
+const schedulePollInterval = 10 * time.Second
+
+// scheduleGrace is how late a scheduled message may be when the listener
+// starts and still count as on time rather than missed.
+const scheduleGrace = time.Minute
+
+// A schedule is pending while sent_at is NULL. Once handled, error is NULL
+// if it was sent and says why otherwise, including skipped missed ones.
+const scheduledMessagesSchema = `CREATE TABLE IF NOT EXISTS scheduled_messages (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	recipient  TEXT    NOT NULL,
+	send_at    INTEGER NOT NULL,
+	text       TEXT    NOT NULL,
+	created_at INTEGER NOT NULL,
+	sent_at    INTEGER,
+	message_id TEXT,
+	error      TEXT
+)`
+
+// scheduledMessage is a row of the scheduled_messages table.
+type scheduledMessage struct {
+	ID        int64
+	Recipient string
+	SendAt    time.Time
+	Text      string
+	SentAt    time.Time
+	MessageID string
+	Error     string
+}
+
+func (m scheduledMessage) status() string {
+	switch {
+	case m.SentAt.IsZero():
+		return "pending"
+	case strings.HasPrefix(m.Error, "skipped"):
+		return m.Error
+	case m.Error != "":
+		return "failed: " + m.Error
+	default:
+		return "sent " + m.SentAt.Local().Format("2006-01-02 15:04:05") + " as " + m.MessageID
+	}
+}
+
+// scheduleStore keeps scheduled messages in the session database, so they
+// survive restarts of the listener that sends them.
+type scheduleStore struct {
+	db *sql.DB
+}
+
+func openScheduleStore(dbPath string) (*scheduleStore, error) {
+	db, err := clientOptions.DB.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open schedule store: %v", err)
+	}
+	if _, err := db.Exec(scheduledMessagesSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create scheduled messages table: %v", err)
+	}
+	return &scheduleStore{db: db}, nil
+}
+
+func (s *scheduleStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *scheduleStore) Add(recipient string, sendAt time.Time, text string) (int64, error) {
+	res, err := s.db.Exec(`INSERT INTO scheduled_messages (recipient, send_at, text, created_at) VALUES (?, ?, ?, ?)`,
+		recipient, sendAt.Unix(), text, time.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to schedule message: %v", err)
+	}
+	return res.LastInsertId()
+}
+
+// Cancel removes a pending schedule, reporting whether there was one.
+func (s *scheduleStore) Cancel(id int64) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM scheduled_messages WHERE id = ? AND sent_at IS NULL`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel scheduled message: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// List returns the schedules in send order, the handled ones only with all.
+func (s *scheduleStore) List(all bool) ([]scheduledMessage, error) {
+	query := `SELECT id, recipient, send_at, text, sent_at, message_id, error FROM scheduled_messages`
+	if !all {
+		query += ` WHERE sent_at IS NULL`
+	}
+	return s.query(query + ` ORDER BY send_at, id`)
+}
+
+// Due returns the pending schedules whose time has come by now.
+func (s *scheduleStore) Due(now time.Time) ([]scheduledMessage, error) {
+	return s.query(`SELECT id, recipient, send_at, text, sent_at, message_id, error FROM scheduled_messages
+		WHERE sent_at IS NULL AND send_at <= ? ORDER BY send_at, id`, now.Unix())
+}
+
+func (s *scheduleStore) query(query string, args ...interface{}) ([]scheduledMessage, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled messages: %v", err)
+	}
+	defer rows.Close()
+
+	var list []scheduledMessage
+	for rows.Next() {
+		var (
+			m         scheduledMessage
+			sendAt    int64
+			sentAt    sql.NullInt64
+			messageID sql.NullString
+			errText   sql.NullString
+		)
+		if err := rows.Scan(&m.ID, &m.Recipient, &sendAt, &m.Text, &sentAt, &messageID, &errText); err != nil {
+			return nil, fmt.Errorf("failed to read scheduled messages: %v", err)
+		}
+		m.SendAt = time.Unix(sendAt, 0)
+		if sentAt.Valid {
+			m.SentAt = time.Unix(sentAt.Int64, 0)
+		}
+		m.MessageID, m.Error = messageID.String, errText.String
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// claim marks a pending schedule as handled before it is sent, so two
+// listeners on the same session never both send it. It reports whether this
+// caller got it.
+func (s *scheduleStore) claim(id int64, now time.Time) (bool, error) {
+	res, err := s.db.Exec(`UPDATE scheduled_messages SET sent_at = ? WHERE id = ? AND sent_at IS NULL`, now.Unix(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update scheduled message: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// finish records the outcome of a claimed schedule.
+func (s *scheduleStore) finish(id int64, messageID string, sendErr error) error {
+	var errText interface{}
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+	if _, err := s.db.Exec(`UPDATE scheduled_messages SET message_id = ?, error = ? WHERE id = ?`, messageID, errText, id); err != nil {
+		return fmt.Errorf("failed to update scheduled message: %v", err)
+	}
+	return nil
+}
+
+// scheduleTimeLayouts are accepted besides RFC3339 for times without an
+// offset, which are read in --tz.
+var scheduleTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parseScheduleTime reads an RFC3339 time, or a time without an offset in
+// loc. A time with an offset of its own is never reinterpreted.
+func parseScheduleTime(value string, loc *time.Location, tzGiven bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		if tzGiven {
+			return time.Time{}, fmt.Errorf("%q has its own offset; --tz only applies to times without one", value)
+		}
+		return t, nil
+	}
+	for _, layout := range scheduleTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want RFC3339 like 2024-05-01T09:00:00+02:00, or 2024-05-01 09:00 in --tz)", value)
+}
+
+// scheduleOptions are the listener's flags for sending scheduled messages.
+type scheduleOptions struct {
+	enabled bool
+	missed  string
+}
+
+func (o *scheduleOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.enabled, "send-scheduled", false, "send messages queued with the schedule command when they are due")
+	fs.StringVar(&o.missed, "missed-schedules", "send", "scheduled messages that came due while nothing was running: send (now) or skip")
+}
+
+func (o *scheduleOptions) validate() error {
+	if o.missed != "send" && o.missed != "skip" {
+		return fmt.Errorf("invalid --missed-schedules %q: must be send or skip", o.missed)
+	}
+	return nil
+}
+
+// run sends due scheduled messages while connected, until ctx is
+// cancelled. Those more than scheduleGrace overdue at startedAt were missed
+// and are handled according to --missed-schedules.
+func (o *scheduleOptions) run(ctx context.Context, client *whatsappclient.Client, store *scheduleStore, startedAt time.Time) {
+	ticker := time.NewTicker(schedulePollInterval)
+	defer ticker.Stop()
+
+	for {
+		if client.IsConnected() && client.IsLoggedIn() {
+			o.sendDue(ctx, client, store, startedAt)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *scheduleOptions) sendDue(ctx context.Context, client *whatsappclient.Client, store *scheduleStore, startedAt time.Time) {
+	due, err := store.Due(time.Now())
+	if err != nil {
+		fmt.Printf("[Schedule] %v\n", err)
+		return
+	}
+	for _, m := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if ok, err := store.claim(m.ID, time.Now()); err != nil {
+			fmt.Printf("[Schedule] %v\n", err)
+			continue
+		} else if !ok {
+			continue
+		}
+
+		var messageID string
+		if o.missed == "skip" && m.SendAt.Before(startedAt.Add(-scheduleGrace)) {
+			err = fmt.Errorf("skipped, was due %s while nothing was running", m.SendAt.Local().Format("2006-01-02 15:04:05"))
+			fmt.Printf("[Schedule] #%d to %s %v\n", m.ID, m.Recipient, err)
+		} else if messageID, err = sendScheduled(ctx, client, m); err != nil {
+			fmt.Printf("[Schedule] Failed to send #%d to %s: %v\n", m.ID, m.Recipient, err)
+		}
+		if err := store.finish(m.ID, messageID, err); err != nil {
+			fmt.Printf("[Schedule] %v\n", err)
+		}
+	}
+}
+
+func sendScheduled(ctx context.Context, client *whatsappclient.Client, m scheduledMessage) (string, error) {
+	to, err := client.ResolveRecipient(m.Recipient)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.SendMessage(ctx, to, &waE2E.Message{Conversation: proto.String(m.Text)})
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("[Schedule] Sent #%d to %s (ID: %s, due %s)\n", m.ID, to.String(), resp.ID, m.SendAt.Local().Format("2006-01-02 15:04:05"))
+	return resp.ID, nil
+}
+
+func scheduleMessage(args []string) error {
+	fs := newFlagSet("schedule")
+	tz := fs.String("tz", "", "time zone for times without an offset, e.g. Europe/Berlin (default: local)")
+	list := fs.Bool("list", false, "list pending scheduled messages")
+	all := fs.Bool("all", false, "with --list, also show sent, failed and skipped ones")
+	cancel := fs.String("cancel", "", "cancel the pending scheduled message with this number")
+	args = parseCommandFlags(fs, args)
+
+	dbPath, err := whatsappclient.ResolveDBPath(clientOptions.DBPath)
+	if err != nil {
+		return err
+	}
+
+	if *list || *cancel != "" {
+		if len(args) > 0 || (*list && *cancel != "") {
+			fmt.Println("Usage: schedule --list [--all] | schedule --cancel <number>")
+			return errUsage
+		}
+		store, err := openScheduleStore(dbPath)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if *cancel != "" {
+			return cancelScheduled(store, *cancel)
+		}
+		return listScheduled(store, *all)
+	}
+
+	if len(args) != 3 {
+		fmt.Println("Usage: schedule <recipient> <time> <text|->")
+		fmt.Println("       schedule --list [--all] | schedule --cancel <number>")
+		return errUsage
+	}
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return err
+	}
+
+	loc := time.Local
+	if *tz != "" {
+		if loc, err = time.LoadLocation(*tz); err != nil {
+			return fmt.Errorf("invalid --tz %q: %v", *tz, err)
+		}
+	}
+	sendAt, err := parseScheduleTime(args[1], loc, *tz != "")
+	if err != nil {
+		return err
+	}
+	if !sendAt.After(time.Now()) {
+		return fmt.Errorf("%s is in the past", sendAt.Local().Format("2006-01-02 15:04:05 MST"))
+	}
+
+	text := args[2]
+	if text == "-" {
+		if text, err = readMessageText("-", false); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("message text is empty")
+	}
+
+	store, err := openScheduleStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	id, err := store.Add(args[0], sendAt, text)
+	if err != nil {
+		return err
+	}
+	// Show the time both ways, so a wrong zone is easy to spot
+	fmt.Printf("Scheduled #%d to %s at %s (%s)\n", id, args[0], sendAt.Local().Format("2006-01-02 15:04:05 MST"), sendAt.UTC().Format(time.RFC3339))
+	fmt.Println("It is sent by a listener running with --send-scheduled, e.g. 'go run . message --send-scheduled'")
+	return nil
+}
+
+func listScheduled(store *scheduleStore, all bool) error {
+	list, err := store.List(all)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Println("No scheduled messages")
+		return nil
+	}
+	for _, m := range list {
+		fmt.Printf("#%-4d %s  %-28s %s\n", m.ID, m.SendAt.Local().Format("2006-01-02 15:04:05"), m.Recipient, m.status())
+		fmt.Printf("      %s\n", strings.Join(strings.Fields(m.Text), " "))
+	}
+	return nil
+}
+
+func cancelScheduled(store *scheduleStore, value string) error {
+	id, err := strconv.ParseInt(strings.TrimPrefix(value, "#"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid --cancel %q: want the number shown by --list", value)
+	}
+	ok, err := store.Cancel(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no pending scheduled message #%d", id)
+	}
+	fmt.Printf("Cancelled scheduled message #%d\n", id)
+	return nil
+}
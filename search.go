@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// searchSchema is a full-text index over the content of stored messages,
+// kept in sync by triggers. The trigram tokenizer matches any substring of
+// three or more characters, case-insensitively, like the LIKE fallback.
+const searchSchema = `
+CREATE VIRTUAL TABLE messages_fts USING fts5(content, content='messages', tokenize='trigram');
+CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+END;
+CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages BEGIN
+	INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+END;
+CREATE TRIGGER messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+	INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+	INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+END;
+INSERT INTO messages_fts(messages_fts) VALUES ('rebuild');`
+
+// createSearchIndex adds the search index to a message store that doesn't
+// have one yet, indexing the messages already stored. It reports whether
+// the index is there; SQLite builds without FTS5 search with LIKE instead.
+// A store indexed by a build with FTS5 can't be written by one without, as
+// its triggers update the index, so opening it fails.
+func createSearchIndex(db *sql.DB) (bool, error) {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'messages_fts'`).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to check for the search index: %v", err)
+	}
+	fts5 := hasFTS5(db)
+	if n > 0 {
+		if !fts5 {
+			return false, fmt.Errorf("the message store has a full-text search index, but this SQLite build has no FTS5; rebuild with go build -tags \"sqlite_mattn sqlite_fts5\" or use the default driver")
+		}
+		return true, nil
+	}
+	if !fts5 {
+		return false, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to create search index: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(searchSchema); err != nil {
+		return false, fmt.Errorf("failed to create search index: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to create search index: %v", err)
+	}
+	return true, nil
+}
+
+func hasFTS5(db *sql.DB) bool {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_compile_options WHERE compile_options = 'ENABLE_FTS5'`).Scan(&n)
+	return err == nil && n > 0
+}
+
+// Search returns the stored messages whose content contains query, ignoring
+// case, newest first. A non-empty chat limits it to that chat, and limit
+// caps the results (0 = all).
+func (s *messageStore) Search(query string, chat types.JID, limit int) ([]storedMessage, error) {
+	var (
+		sqlQuery = `SELECT m.chat, m.id, m.sender, m.sender_name, m.is_from_me, m.timestamp, m.type, m.content FROM messages m`
+		conds    []string
+		args     []interface{}
+	)
+	// Trigrams can't match anything shorter than three characters
+	if s.fts && len([]rune(query)) >= 3 {
+		sqlQuery += ` JOIN messages_fts f ON f.rowid = m.rowid`
+		conds = append(conds, `messages_fts MATCH ?`)
+		args = append(args, `"`+strings.ReplaceAll(query, `"`, `""`)+`"`)
+	} else {
+		conds = append(conds, `m.content LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(query)+"%")
+	}
+	if !chat.IsEmpty() {
+		conds = append(conds, `m.chat = ?`)
+		args = append(args, chat.String())
+	}
+	sqlQuery += ` WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY m.timestamp DESC`
+	if limit > 0 {
+		sqlQuery += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %v", err)
+	}
+	defer rows.Close()
+
+	var found []storedMessage
+	for rows.Next() {
+		var (
+			m                  storedMessage
+			chatStr, senderStr string
+			timestamp          int64
+		)
+		if err := rows.Scan(&chatStr, &m.ID, &senderStr, &m.SenderName, &m.IsFromMe, &timestamp, &m.Type, &m.Content); err != nil {
+			return nil, fmt.Errorf("failed to read search results: %v", err)
+		}
+		m.Chat, _ = types.ParseJID(chatStr)
+		m.Sender, _ = types.ParseJID(senderStr)
+		m.Timestamp = time.Unix(timestamp, 0)
+		found = append(found, m)
+	}
+	return found, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// snippetContext is how much of the content before a match a snippet
+// shows, and snippetWidth how long it is in all.
+const (
+	snippetContext = 30
+	snippetWidth   = 100
+)
+
+// searchSnippet cuts the part of content around the first match of query,
+// with whitespace folded and the match marked: in bold with color, or
+// between « and » otherwise.
+func searchSnippet(content, query string, color bool) string {
+	text := []rune(strings.Join(strings.Fields(content), " "))
+	q := []rune(query)
+	at := indexFold(text, q)
+	if at < 0 {
+		// Not found after folding whitespace, e.g. a query spanning a line
+		// break; show the start
+		if len(text) > snippetWidth {
+			return string(text[:snippetWidth-1]) + "…"
+		}
+		return string(text)
+	}
+
+	start := max(at-snippetContext, 0)
+	end := min(max(start+snippetWidth, at+len(q)), len(text))
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(text) {
+		suffix = "…"
+	}
+	match := string(text[at : at+len(q)])
+	if color {
+		match = paint(ansiBold, match)
+	} else {
+		match = "«" + match + "»"
+	}
+	return prefix + string(text[start:at]) + match + string(text[at+len(q):end]) + suffix
+}
+
+// indexFold finds q in text ignoring case, comparing rune by rune so the
+// index is valid in text.
+func indexFold(text, q []rune) int {
+	if len(q) == 0 {
+		return -1
+	}
+	for i := 0; i+len(q) <= len(text); i++ {
+		match := true
+		for j, r := range q {
+			if unicode.ToLower(text[i+j]) != unicode.ToLower(r) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+func searchMessages(args []string) error {
+	fs := newFlagSet("search")
+	chatFlag := fs.String("chat", "", "only search this chat (phone number or JID)")
+	limit := fs.Int("limit", 20, "show at most this many matches, newest first (0 = all)")
+	noColor := fs.Bool("no-color", false, "mark matches with « » instead of bold")
+	storePath := bindSetting(fs, messagesDBSetting)
+	args = parseCommandFlags(fs, args, storePath)
+
+	if len(args) == 0 {
+		fmt.Println("Usage: search <query> [--chat <chat>] [--limit <n>]")
+		return errUsage
+	}
+	// Allow unquoted multi-word queries
+	query := strings.Join(args, " ")
+	if *limit < 0 {
+		return fmt.Errorf("--limit must not be negative")
+	}
+
+	var chat types.JID
+	if *chatFlag != "" {
+		var err error
+		if chat, err = whatsappclient.ParseRecipient(*chatFlag); err != nil {
+			return fmt.Errorf("invalid --chat: %v", err)
+		}
+	}
+
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	found, err := store.Search(query, chat, *limit)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		fmt.Printf("No stored messages contain %q\n", query)
+		return nil
+	}
+
+	color := !*noColor && stdoutHasColor()
+	for _, m := range found {
+		sender := m.SenderName
+		if m.IsFromMe {
+			sender = "me"
+		} else if sender == "" {
+			sender = m.Sender.String()
+		}
+		// The chat and ID are what download and forward take
+		fmt.Printf("%s  %s  %s  %s: %s\n", m.Timestamp.Local().Format("2006-01-02 15:04:05"), m.Chat.String(), m.ID, sender, searchSnippet(m.Content, query, color))
+	}
+	if *limit > 0 && len(found) == *limit {
+		fmt.Printf("(showing the newest %d; raise --limit for more)\n", *limit)
+	}
+	return nil
+}
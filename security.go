@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// printSecurityEvent prints safety number changes, which happen when a
+// contact re-registers WhatsApp or, less benignly, when someone else does.
+func printSecurityEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.IdentityChange:
+		fmt.Printf("[Security] Identity of %s changed at %s (implicit: %t)\n", formatJID(v.JID), v.Timestamp.Local().Format("2006-01-02 15:04:05"), v.Implicit)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// connectClient sets up a client from the stored session and waits until it
+// is connected and logged in, ready for sending.
+func connectClient() (*whatsappclient.Client, error) {
+	client, err := setupClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up client: %v", err)
+	}
+
+	if err := connectAndWait(client); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// connectAndWait connects an already set up client and waits until it is
+// logged in.
+func connectAndWait(client *whatsappclient.Client) error {
+	if !isLoggedIn(client) {
+		return errNotLoggedIn(client)
+	}
+
+	err := client.Connect()
+	if err != nil {
+		return errConnectFailed(client, err)
+	}
+
+	if !client.WaitForConnection(30 * time.Second) {
+		client.Disconnect()
+		return errConnectFailed(client, fmt.Errorf("timed out waiting for connection"))
+	}
+
+	return nil
+}
+
+// parseLocation validates the latitude and longitude arguments of send-location.
+func parseLocation(latArg, lngArg string) (float64, float64, error) {
+	lat, err := strconv.ParseFloat(latArg, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid latitude %q: %v", latArg, err)
+	}
+	if lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("latitude %v out of range [-90,90]", lat)
+	}
+
+	lng, err := strconv.ParseFloat(lngArg, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid longitude %q: %v", lngArg, err)
+	}
+	if lng < -180 || lng > 180 {
+		return 0, 0, fmt.Errorf("longitude %v out of range [-180,180]", lng)
+	}
+
+	return lat, lng, nil
+}
+
+// buildLocation validates the send-location arguments and builds the message.
+// The recipient is returned unresolved, since "me" needs the session.
+func buildLocation(args []string) (string, *waE2E.Message, error) {
+	if len(args) < 3 || len(args) > 5 {
+		return "", nil, fmt.Errorf("usage: send-location <recipient> <lat> <lng> [name] [address]")
+	}
+
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return "", nil, err
+	}
+
+	lat, lng, err := parseLocation(args[1], args[2])
+	if err != nil {
+		return "", nil, err
+	}
+
+	location := &waE2E.LocationMessage{
+		DegreesLatitude:  proto.Float64(lat),
+		DegreesLongitude: proto.Float64(lng),
+	}
+	if len(args) > 3 {
+		location.Name = proto.String(args[3])
+	}
+	if len(args) > 4 {
+		location.Address = proto.String(args[4])
+	}
+
+	return args[0], &waE2E.Message{LocationMessage: location}, nil
+}
+
+// sendAndReport resolves recipient, sends msg and prints the outcome,
+// describing it as what.
+func sendAndReport(ctx context.Context, m messenger, recipient string, msg *waE2E.Message, what string) error {
+	to, err := m.ResolveRecipient(recipient)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.SendMessage(ctx, to, msg)
+	if err != nil {
+		return withExitCode(exitSendFailure, fmt.Errorf("failed to send %s: %v", what, err))
+	}
+
+	fmt.Printf("%s sent to %s (ID: %s, Time: %s)\n", strings.ToUpper(what[:1])+what[1:], to.String(), resp.ID, resp.Timestamp.Local().Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+func sendLocation(ctx context.Context, args []string) error {
+	fs := newFlagSet("send-location")
+	var ephemeral ephemeralOptions
+	ephemeral.register(fs)
+	args = parseCommandFlags(fs, args)
+
+	recipient, msg, err := buildLocation(args)
+	if err != nil {
+		return err
+	}
+	if err := ephemeral.validate(); err != nil {
+		return err
+	}
+
+	client, err := connectMessenger()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := ephemeral.apply(client, recipient, msg); err != nil {
+		return err
+	}
+
+	return sendAndReport(ctx, client, recipient, msg, "location")
+}
+
+// splitRecipients flattens recipient arguments, each of which may be a
+// comma-separated list.
+func splitRecipients(args []string) []string {
+	var recipients []string
+	for _, arg := range args {
+		for _, r := range strings.Split(arg, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				recipients = append(recipients, r)
+			}
+		}
+	}
+	return recipients
+}
+
+// readMessageText reads a message body from path, or from stdin when path
+// is "-". Trailing newlines are dropped unless keepNewlines is set, since
+// echo and most editors add one.
+func readMessageText(path string, keepNewlines bool) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read message text: %v", err)
+	}
+
+	text := string(data)
+	if !keepNewlines {
+		text = strings.TrimRight(text, "\r\n")
+	}
+	return text, nil
+}
+
+func sendText(ctx context.Context, args []string) error {
+	fs := newFlagSet("send")
+	file := fs.String("file", "", "read the message text from this file instead of an argument")
+	noTrim := fs.Bool("no-trim", false, "keep trailing newlines of text read from stdin or --file")
+	var ephemeral ephemeralOptions
+	ephemeral.register(fs)
+	var mentions mentionOptions
+	mentions.register(fs)
+	var opts bulkOptions
+	opts.register(fs)
+	args = parseCommandFlags(fs, args)
+
+	// With --file every argument is a recipient; otherwise the last argument
+	// is the text, and "-" reads it from stdin
+	var text string
+	if *file != "" {
+		if len(args) < 1 {
+			fmt.Println("Usage: send <recipient>[,<recipient>...] [<recipient>...] --file <path>")
+			return errUsage
+		}
+		var err error
+		if text, err = readMessageText(*file, *noTrim); err != nil {
+			return err
+		}
+	} else {
+		if len(args) < 2 {
+			fmt.Println("Usage: send <recipient>[,<recipient>...] [<recipient>...] <text|->")
+			return errUsage
+		}
+		text = args[len(args)-1]
+		args = args[:len(args)-1]
+		if text == "-" {
+			var err error
+			if text, err = readMessageText("-", *noTrim); err != nil {
+				return err
+			}
+		}
+	}
+
+	recipients := splitRecipients(args)
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients given")
+	}
+	for _, r := range recipients {
+		if err := whatsappclient.ValidateRecipient(r); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("message text is empty")
+	}
+	if err := ephemeral.validate(); err != nil {
+		return err
+	}
+	if err := mentions.validate(); err != nil {
+		return err
+	}
+	text = mentions.formatText(text)
+
+	if opts.dryRun {
+		for _, r := range recipients {
+			fmt.Printf("Would send to %s: %s\n", r, text)
+		}
+		return nil
+	}
+
+	client, err := connectMessenger()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	// Carry on past individual failures and report each recipient
+	failed := 0
+	for i, r := range recipients {
+		if i > 0 && sleepContext(ctx, opts.interval()) != nil {
+			fmt.Println("Interrupted, stopping")
+			failed += len(recipients) - i
+			break
+		}
+
+		msg := &waE2E.Message{Conversation: proto.String(text)}
+		if err := mentions.apply(client, r, msg); err != nil {
+			fmt.Printf("Error: %s: %v\n", r, err)
+			failed++
+			continue
+		}
+		if err := ephemeral.apply(client, r, msg); err != nil {
+			fmt.Printf("Error: %s: %v\n", r, err)
+			failed++
+			continue
+		}
+
+		resp, err := sendWithRetry(ctx, client, r, msg, &opts)
+		if err != nil {
+			fmt.Printf("Error: failed to send message to %s: %v\n", r, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Message sent to %s (ID: %s, Time: %s)\n", r, resp.ID, resp.Timestamp.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	if len(recipients) > 1 {
+		fmt.Printf("\n%d sent, %d failed\n", len(recipients)-failed, failed)
+	}
+	if failed > 0 {
+		return withExitCode(exitSendFailure, fmt.Errorf("%d of %d messages failed", failed, len(recipients)))
+	}
+	return nil
+}
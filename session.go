@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"golang.org/x/crypto/scrypt"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// sessionFileMagic starts every exported session file, and is authenticated
+// along with the contents.
+var sessionFileMagic = []byte("WASESS1\n")
+
+// sessionPassphrase encrypts exported session files.
+var sessionPassphrase string
+
+var sessionPassphraseSetting = setting{
+	flag:   "passphrase",
+	env:    "WHATSAPP_SESSION_PASSPHRASE",
+	usage:  "passphrase the session file is encrypted with (default: prompt)",
+	target: &sessionPassphrase,
+}
+
+// sessionTables are the whatsmeow tables holding a device's state, with the
+// column naming the device, in an order that satisfies their foreign keys.
+// App-state mutation MACs must follow the versions they belong to.
+var sessionTables = []struct{ name, owner string }{
+	{"whatsmeow_device", "jid"},
+	{"whatsmeow_identity_keys", "our_jid"},
+	{"whatsmeow_pre_keys", "jid"},
+	{"whatsmeow_sessions", "our_jid"},
+	{"whatsmeow_sender_keys", "our_jid"},
+	{"whatsmeow_app_state_sync_keys", "jid"},
+	{"whatsmeow_app_state_version", "jid"},
+	{"whatsmeow_app_state_mutation_macs", "jid"},
+	{"whatsmeow_contacts", "our_jid"},
+	{"whatsmeow_chat_settings", "our_jid"},
+	{"whatsmeow_message_secrets", "our_jid"},
+	{"whatsmeow_privacy_tokens", "our_jid"},
+}
+
+// sessionExport is the decrypted contents of a session file: every row
+// belonging to one device, copied column for column so keys round-trip
+// byte for byte.
+type sessionExport struct {
+	JID string
+	// SchemaVersion is the whatsmeow_version of the exporting database
+	SchemaVersion int
+	Tables        []sessionTable
+}
+
+type sessionTable struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func init() {
+	// SQLite hands back int64, float64, string and []byte, which gob knows;
+	// register bool too in case the driver maps BOOLEAN columns to it
+	gob.Register(false)
+}
+
+func readSessionExport(db *sql.DB, jid string) (*sessionExport, error) {
+	export := &sessionExport{JID: jid}
+	if err := db.QueryRow("SELECT version FROM whatsmeow_version").Scan(&export.SchemaVersion); err != nil {
+		return nil, fmt.Errorf("failed to read database version: %v", err)
+	}
+
+	for _, t := range sessionTables {
+		rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s = ?", t.name, t.owner), jid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", t.name, err)
+		}
+		table := sessionTable{Name: t.name}
+		table.Columns, err = rows.Columns()
+		for err == nil && rows.Next() {
+			row := make([]interface{}, len(table.Columns))
+			ptrs := make([]interface{}, len(row))
+			for i := range row {
+				ptrs[i] = &row[i]
+			}
+			if err = rows.Scan(ptrs...); err == nil {
+				table.Rows = append(table.Rows, row)
+			}
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", t.name, err)
+		}
+		export.Tables = append(export.Tables, table)
+	}
+	return export, nil
+}
+
+// writeSessionExport inserts export into db in one transaction. Columns are
+// named explicitly, so an export from an older schema leaves columns added
+// since at their defaults.
+func writeSessionExport(db *sql.DB, export *sessionExport) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range export.Tables {
+		if len(table.Rows) == 0 {
+			continue
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.Name, strings.Join(table.Columns, ", "), placeholders)
+		for _, row := range table.Rows {
+			if _, err := tx.Exec(query, row...); err != nil {
+				return fmt.Errorf("failed to write %s: %v", table.Name, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// sessionKey derives the file encryption key from the passphrase.
+func sessionKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSession lays the file out as magic, scrypt salt, GCM nonce and the
+// sealed gob-encoded export.
+func encryptSession(export *sessionExport, passphrase string) ([]byte, error) {
+	var plain bytes.Buffer
+	if err := gob.NewEncoder(&plain).Encode(export); err != nil {
+		return nil, fmt.Errorf("failed to encode session: %v", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := sessionKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(append(append([]byte{}, sessionFileMagic...), salt...), nonce...)
+	return aead.Seal(out, nonce, plain.Bytes(), sessionFileMagic), nil
+}
+
+func decryptSession(data []byte, passphrase string) (*sessionExport, error) {
+	if !bytes.HasPrefix(data, sessionFileMagic) {
+		return nil, fmt.Errorf("not an exported session file")
+	}
+	data = data[len(sessionFileMagic):]
+	if len(data) < 16 {
+		return nil, fmt.Errorf("session file is truncated")
+	}
+	aead, err := sessionKey(passphrase, data[:16])
+	if err != nil {
+		return nil, err
+	}
+	data = data[16:]
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("session file is truncated")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], sessionFileMagic)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase, or the session file is corrupted")
+	}
+
+	export := &sessionExport{}
+	if err := gob.NewDecoder(bytes.NewReader(plain)).Decode(export); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %v", err)
+	}
+	return export, nil
+}
+
+// readPassphrase returns --passphrase, or prompts for it on stdin. The
+// prompt echoes what is typed, so scripts should use
+// WHATSAPP_SESSION_PASSPHRASE instead.
+func readPassphrase(confirm bool) (string, error) {
+	if sessionPassphrase != "" {
+		return sessionPassphrase, nil
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	prompt := func(label string) (string, error) {
+		fmt.Print(label)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("no passphrase given")
+		}
+		return strings.TrimRight(scanner.Text(), "\r"), nil
+	}
+
+	passphrase, err := prompt("Passphrase (shown as you type): ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the passphrase must not be empty")
+	}
+	if confirm {
+		again, err := prompt("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
+
+func exportSession(args []string) error {
+	fs := newFlagSet("export-session")
+	passphrase := bindSetting(fs, sessionPassphraseSetting)
+	args = parseCommandFlags(fs, args, passphrase)
+
+	if len(args) != 1 {
+		fmt.Println("Usage: export-session <file> [--passphrase <passphrase>]")
+		return errUsage
+	}
+	path := args[0]
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("failed to set up client: %v", err)
+	}
+	defer client.Close()
+	if !client.Registered {
+		return errNotLoggedIn(client)
+	}
+
+	pass, err := readPassphrase(true)
+	if err != nil {
+		return err
+	}
+
+	db, err := clientOptions.DB.Open(client.DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	export, err := readSessionExport(db, client.Store.ID.String())
+	if err != nil {
+		return err
+	}
+	data, err := encryptSession(export, pass)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session file: %v", err)
+	}
+
+	fmt.Printf("Exported session %s to %s\n", export.JID, path)
+	fmt.Println("WARNING: this file holds the account's encryption keys. Anyone with it and")
+	fmt.Println("the passphrase can read and send messages as you. Delete it once imported.")
+	return nil
+}
+
+func importSession(args []string) error {
+	fs := newFlagSet("import-session")
+	passphrase := bindSetting(fs, sessionPassphraseSetting)
+	args = parseCommandFlags(fs, args, passphrase)
+
+	if len(args) != 1 {
+		fmt.Println("Usage: import-session <file> [--passphrase <passphrase>]")
+		return errUsage
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read session file: %v", err)
+	}
+	pass, err := readPassphrase(false)
+	if err != nil {
+		return err
+	}
+	export, err := decryptSession(data, pass)
+	if err != nil {
+		return err
+	}
+
+	dbPath, err := whatsappclient.ResolveDBPath(clientOptions.DBPath)
+	if err != nil {
+		return err
+	}
+	// Back up before Upgrade touches the schema
+	if err := backupBeforeChange(dbPath); err != nil {
+		return err
+	}
+	db, err := clientOptions.DB.Open(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Create or upgrade the schema the same way New does
+	container := sqlstore.NewWithDB(db, clientOptions.DB.DriverName(), waLog.Noop)
+	if err := container.Upgrade(); err != nil {
+		return fmt.Errorf("failed to prepare database: %v", err)
+	}
+	var version int
+	if err := db.QueryRow("SELECT version FROM whatsmeow_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read database version: %v", err)
+	}
+	if export.SchemaVersion > version {
+		return fmt.Errorf("the session was exported by a newer whatsmeow (schema v%d, this build has v%d); update this build first", export.SchemaVersion, version)
+	}
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM whatsmeow_device WHERE jid = ?", export.JID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check existing sessions: %v", err)
+	}
+	if exists > 0 {
+		return fmt.Errorf("%s already holds session %s", dbPath, export.JID)
+	}
+	if err := writeSessionExport(db, export); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported session %s into %s\n", export.JID, dbPath)
+	fmt.Println("Stop using the session on the old machine: whichever connects last replaces the other.")
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waAdv"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// openTestContainer opens a session database at path the way import-session
+// does.
+func openTestContainer(t *testing.T, path string) *sqlstore.Container {
+	db, err := clientOptions.DB.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	container := sqlstore.NewWithDB(db, clientOptions.DB.DriverName(), waLog.Noop)
+	if err := container.Upgrade(); err != nil {
+		t.Fatalf("failed to prepare %s: %v", path, err)
+	}
+	return container
+}
+
+// fillTestDevice saves a logged-in device with a row in every table
+// sessionTables copies.
+func fillTestDevice(t *testing.T, container *sqlstore.Container) *store.Device {
+	device := container.NewDevice()
+	jid := types.NewADJID("15550000000", 0, 3)
+	device.ID = &jid
+	device.Account = &waAdv.ADVSignedDeviceIdentity{
+		Details:             []byte("details"),
+		AccountSignatureKey: bytes.Repeat([]byte{1}, 32),
+		AccountSignature:    bytes.Repeat([]byte{2}, 64),
+		DeviceSignature:     bytes.Repeat([]byte{3}, 64),
+	}
+	if err := container.PutDevice(device); err != nil {
+		t.Fatalf("failed to save device: %v", err)
+	}
+
+	contact := types.NewJID("15551234567", types.DefaultUserServer)
+	group := types.NewJID("120363025246125486", types.GroupServer)
+	var hash [128]byte
+	steps := []struct {
+		table string
+		err   error
+	}{
+		{"identity keys", device.Identities.PutIdentity(contact.SignalAddress().String(), [32]byte{4})},
+		{"sessions", device.Sessions.PutSession(contact.SignalAddress().String(), []byte("session"))},
+		{"sender keys", device.SenderKeys.PutSenderKey(group.String(), contact.SignalAddress().String(), []byte("sender key"))},
+		{"app state sync keys", device.AppStateKeys.PutAppStateSyncKey([]byte("key id"), store.AppStateSyncKey{Data: []byte("data"), Fingerprint: []byte("fp"), Timestamp: 1})},
+		{"app state version", device.AppState.PutAppStateVersion("regular", 2, hash)},
+		{"app state mutation MACs", device.AppState.PutAppStateMutationMACs("regular", 2, []store.AppStateMutationMAC{
+			{IndexMAC: bytes.Repeat([]byte{5}, 32), ValueMAC: bytes.Repeat([]byte{6}, 32)},
+		})},
+		{"contacts", device.Contacts.PutContactName(contact, "Ann", "Ann Smith")},
+		{"chat settings", device.ChatSettings.PutMutedUntil(group, time.Unix(2000000000, 0))},
+		{"message secrets", device.MsgSecrets.PutMessageSecret(group, contact, "3EB0ABC", []byte("secret"))},
+		{"privacy tokens", device.PrivacyTokens.PutPrivacyTokens(store.PrivacyToken{User: contact, Token: []byte("token"), Timestamp: time.Unix(1700000000, 0)})},
+	}
+	for _, step := range steps {
+		if step.err != nil {
+			t.Fatalf("failed to fill %s: %v", step.table, step.err)
+		}
+	}
+	if _, err := device.PreKeys.GetOrGenPreKeys(2); err != nil {
+		t.Fatalf("failed to fill pre keys: %v", err)
+	}
+	return device
+}
+
+func TestSessionExportImport(t *testing.T) {
+	dir := t.TempDir()
+	defer func(dbPath, pass string) {
+		clientOptions.DBPath, sessionPassphrase = dbPath, pass
+	}(clientOptions.DBPath, sessionPassphrase)
+
+	srcPath := filepath.Join(dir, "src.db")
+	src := openTestContainer(t, srcPath)
+	device := fillTestDevice(t, src)
+	srcDB, err := clientOptions.DB.Open(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srcDB.Close()
+	want, err := readSessionExport(srcDB, device.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range want.Tables {
+		if len(table.Rows) == 0 {
+			t.Fatalf("test device has no rows in %s", table.Name)
+		}
+	}
+
+	file := filepath.Join(dir, "session.wasess")
+	if err := exportSession([]string{"--db-path", srcPath, "--passphrase", "correct horse", file}); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	// A wrong passphrase fails before the database is touched
+	dstPath := filepath.Join(dir, "dst.db")
+	if err := importSession([]string{"--db-path", dstPath, "--passphrase", "battery staple", file}); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("import with a wrong passphrase = %v, want a wrong passphrase error", err)
+	}
+	if _, err := os.Stat(dstPath); !os.IsNotExist(err) {
+		t.Errorf("import with a wrong passphrase created %s", dstPath)
+	}
+
+	if err := importSession([]string{"--db-path", dstPath, "--passphrase", "correct horse", file}); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	dst := openTestContainer(t, dstPath)
+	imported, err := dst.GetDevice(*device.ID)
+	if err != nil || imported == nil {
+		t.Fatalf("imported device not found: %v", err)
+	}
+	if *imported.IdentityKey.Priv != *device.IdentityKey.Priv {
+		t.Errorf("identity key differs after the round trip")
+	}
+	if imported.SignedPreKey.KeyID != device.SignedPreKey.KeyID || *imported.SignedPreKey.Priv != *device.SignedPreKey.Priv ||
+		*imported.SignedPreKey.Signature != *device.SignedPreKey.Signature {
+		t.Errorf("signed pre-key differs after the round trip")
+	}
+	if imported.RegistrationID != device.RegistrationID {
+		t.Errorf("registration ID = %d, want %d", imported.RegistrationID, device.RegistrationID)
+	}
+
+	dstDB, err := clientOptions.DB.Open(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dstDB.Close()
+	got, err := readSessionExport(dstDB, device.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, table := range want.Tables {
+		if !reflect.DeepEqual(got.Tables[i], table) {
+			t.Errorf("%s differs after the round trip:\n%v\nwant:\n%v", table.Name, got.Tables[i].Rows, table.Rows)
+		}
+	}
+}
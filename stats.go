@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// statsFilter narrows the stored messages the stats are computed over. Zero
+// fields don't filter.
+type statsFilter struct {
+	chat  types.JID
+	since time.Time
+	until time.Time
+}
+
+// where renders the filter as an SQL condition and its arguments.
+func (f statsFilter) where() (string, []interface{}) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	if !f.chat.IsEmpty() {
+		conds = append(conds, "chat = ?")
+		args = append(args, f.chat.String())
+	}
+	if !f.since.IsZero() {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, f.since.Unix())
+	}
+	if !f.until.IsZero() {
+		conds = append(conds, "timestamp < ?")
+		args = append(args, f.until.Unix())
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// statCount is one row of a stats breakdown.
+type statCount struct {
+	Key   string `json:"key"`
+	Name  string `json:"name,omitempty"`
+	Count int    `json:"count"`
+}
+
+// messageStats summarises the stored history.
+type messageStats struct {
+	Total    int         `json:"total"`
+	ByType   []statCount `json:"by_type"`
+	BySender []statCount `json:"by_sender"`
+	ByDay    []statCount `json:"by_day"`
+	TopChats []statCount `json:"top_chats"`
+}
+
+// countBy runs a GROUP BY query over the filtered messages. column is the
+// grouping expression and name an optional display name for each group.
+func (s *messageStore) countBy(f statsFilter, column, name, order string, limit int) ([]statCount, error) {
+	if name == "" {
+		name = "''"
+	}
+	where, args := f.where()
+	query := fmt.Sprintf(`SELECT %s AS k, MAX(%s), COUNT(*) AS n FROM messages WHERE %s GROUP BY k ORDER BY %s`, column, name, where, order)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message stats: %v", err)
+	}
+	defer rows.Close()
+
+	counts := []statCount{}
+	for rows.Next() {
+		var c statCount
+		if err := rows.Scan(&c.Key, &c.Name, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to read message stats: %v", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Stats aggregates the stored messages matching f. limit caps the sender
+// and chat breakdowns.
+func (s *messageStore) Stats(f statsFilter, limit int) (*messageStats, error) {
+	where, args := f.where()
+	stats := &messageStats{}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE `+where, args...).Scan(&stats.Total); err != nil {
+		return nil, fmt.Errorf("failed to count messages: %v", err)
+	}
+
+	var err error
+	if stats.ByType, err = s.countBy(f, "type", "", "n DESC, k", 0); err != nil {
+		return nil, err
+	}
+	if stats.BySender, err = s.countBy(f, "sender", "sender_name", "n DESC, k", limit); err != nil {
+		return nil, err
+	}
+	if stats.ByDay, err = s.countBy(f, "date(timestamp, 'unixepoch', 'localtime')", "", "k", 0); err != nil {
+		return nil, err
+	}
+	if stats.TopChats, err = s.countBy(f, "chat", "", "n DESC, k", limit); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func printStatsTable(title string, counts []statCount) {
+	fmt.Printf("\n%s:\n", title)
+	if len(counts) == 0 {
+		fmt.Println("  (none)")
+		return
+	}
+	for _, c := range counts {
+		if c.Name != "" {
+			fmt.Printf("  %-40s %7d  %s\n", c.Key, c.Count, c.Name)
+		} else {
+			fmt.Printf("  %-40s %7d\n", c.Key, c.Count)
+		}
+	}
+}
+
+// parseStatsTime accepts an RFC3339 time or a local date (2006-01-02).
+func parseStatsTime(flagName, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s %q (want 2006-01-02 or RFC3339)", flagName, value)
+	}
+	return t, nil
+}
+
+// openHistory opens the message store for commands that read the recorded
+// history. History only exists if the listener recorded it, so an empty
+// database isn't created just to report nothing.
+func openHistory() (*messageStore, error) {
+	dbPath, err := whatsappclient.ResolveDBPath(clientOptions.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	dbPath = messageStorePath(dbPath)
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("no database at %s. Run 'go run . message --store-messages' to record messages", dbPath)
+	}
+	return openMessageStore(dbPath)
+}
+
+func showStats(args []string) error {
+	fs := newFlagSet("stats")
+	sinceFlag := fs.String("since", "", "only count messages sent at or after this date or RFC3339 time")
+	untilFlag := fs.String("until", "", "only count messages sent before this date or RFC3339 time")
+	limit := fs.Int("limit", 10, "show at most this many senders and chats (0 = all)")
+	asJSON := fs.Bool("json", false, "print the stats as JSON")
+	storePath := bindSetting(fs, messagesDBSetting)
+	args = parseCommandFlags(fs, args, storePath)
+
+	if len(args) > 1 {
+		fmt.Println("Usage: stats [chat] [--since <date>] [--until <date>] [--limit <n>] [--json]")
+		return errUsage
+	}
+
+	var filter statsFilter
+	var err error
+	if len(args) == 1 {
+		if filter.chat, err = whatsappclient.ParseRecipient(args[0]); err != nil {
+			return err
+		}
+	}
+	if filter.since, err = parseStatsTime("since", *sinceFlag); err != nil {
+		return err
+	}
+	if filter.until, err = parseStatsTime("until", *untilFlag); err != nil {
+		return err
+	}
+
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	stats, err := store.Stats(filter, *limit)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("%d stored messages\n", stats.Total)
+	if stats.Total == 0 {
+		return nil
+	}
+	printStatsTable("By type", stats.ByType)
+	printStatsTable("By sender", stats.BySender)
+	printStatsTable("By day", stats.ByDay)
+	if filter.chat.IsEmpty() {
+		printStatsTable("Most active chats", stats.TopChats)
+	}
+	return nil
+}
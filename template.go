@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// placeholderPattern matches {column} placeholders in message templates.
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z0-9_ -]+)\}`)
+
+// compileMessageTemplate turns text with {column} placeholders into a
+// text/template. With strict set, rendering fails on a placeholder that has
+// no value; otherwise it renders as empty.
+func compileMessageTemplate(text string, strict bool) (*template.Template, error) {
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(escapeTemplateText(text[last:m[0]]))
+		fmt.Fprintf(&b, "{{field . %q}}", text[m[2]:m[3]])
+		last = m[1]
+	}
+	b.WriteString(escapeTemplateText(text[last:]))
+
+	funcs := template.FuncMap{
+		"field": func(data map[string]string, key string) (string, error) {
+			if v := data[key]; v != "" {
+				return v, nil
+			}
+			if strict {
+				return "", missingPlaceholderError(key)
+			}
+			return "", nil
+		},
+	}
+
+	tmpl, err := template.New("message").Funcs(funcs).Parse(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// escapeTemplateText keeps literal braces in the user's text from being
+// read as (part of) a template action.
+func escapeTemplateText(s string) string {
+	return strings.ReplaceAll(s, "{", `{{"{"}}`)
+}
+
+// missingPlaceholderError is returned when a strict template has no value
+// for a placeholder.
+type missingPlaceholderError string
+
+func (e missingPlaceholderError) Error() string {
+	return fmt.Sprintf("no value for placeholder {%s}", string(e))
+}
+
+func renderMessageTemplate(tmpl *template.Template, data map[string]string) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		// Report a missing placeholder without text/template's position noise
+		var missing missingPlaceholderError
+		if errors.As(err, &missing) {
+			return "", missing
+		}
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// contactName returns the best known display name for jid from the local
+// contact store, or "" if there is none.
+func contactName(client *whatsappclient.Client, jid types.JID) string {
+	contact, err := client.Store.Contacts.GetContact(jid)
+	if err != nil || !contact.Found {
+		return ""
+	}
+	return displayName(contact)
+}
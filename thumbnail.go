@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// thumbnailSize bounds the longer side of a document preview, about what
+// the phone app attaches itself.
+const thumbnailSize = 480
+
+// documentThumbnail is the JPEG preview shown in place of the file icon.
+type documentThumbnail struct {
+	jpeg          []byte
+	width, height int
+}
+
+// apply attaches t to a document message. A nil t leaves the plain icon.
+func (t *documentThumbnail) apply(msg *waE2E.Message) {
+	if t == nil || msg.DocumentMessage == nil {
+		return
+	}
+	msg.DocumentMessage.JPEGThumbnail = t.jpeg
+	msg.DocumentMessage.ThumbnailWidth = proto.Uint32(uint32(t.width))
+	msg.DocumentMessage.ThumbnailHeight = proto.Uint32(uint32(t.height))
+}
+
+// loadThumbnail reads a JPEG or PNG image and re-encodes it as a JPEG no
+// larger than thumbnailSize, so a full-size photo doesn't bloat the message.
+func loadThumbnail(path string) (*documentThumbnail, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read thumbnail: %v", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a JPEG or PNG image: %v", filepath.Base(path), err)
+	}
+	img = scaleDown(img, thumbnailSize)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %v", err)
+	}
+	bounds := img.Bounds()
+	return &documentThumbnail{jpeg: out.Bytes(), width: bounds.Dx(), height: bounds.Dy()}, nil
+}
+
+// scaleDown shrinks img by nearest-neighbour sampling until its longer side
+// fits limit. That is crude, but fine at thumbnail size.
+func scaleDown(img image.Image, limit int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= limit && h <= limit {
+		return img
+	}
+	tw, th := limit, h*limit/w
+	if h > w {
+		tw, th = w*limit/h, limit
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	out := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			out.Set(x, y, img.At(b.Min.X+x*w/tw, b.Min.Y+y*h/th))
+		}
+	}
+	return out
+}
+
+// documentThumbnailFor loads the --thumbnail given for a document, or tries
+// to render one for a PDF. A thumbnail asked for must load; a rendered one
+// is only nice to have, so the document goes without if it fails.
+func documentThumbnailFor(ctx context.Context, kind, path string, data []byte, thumbnailPath string) (*documentThumbnail, error) {
+	if kind != mediaDocument {
+		return nil, nil
+	}
+	if thumbnailPath != "" {
+		return loadThumbnail(thumbnailPath)
+	}
+	if mimeTypeFor(path, data) != "application/pdf" {
+		return nil, nil
+	}
+	thumbnail, err := renderPDFThumbnail(ctx, path)
+	if err != nil {
+		fmt.Printf("Sending without a preview: %v\n", err)
+		return nil, nil
+	}
+	return thumbnail, nil
+}
+
+// renderPDFThumbnail renders the first page of a PDF with pdftoppm from
+// poppler-utils, when it is installed.
+func renderPDFThumbnail(ctx context.Context, path string) (*documentThumbnail, error) {
+	pdftoppm, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		return nil, fmt.Errorf("pdftoppm (poppler-utils) is not installed")
+	}
+	dir, err := os.MkdirTemp("", "whatsapp-thumb-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	prefix := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, pdftoppm, "-jpeg", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to", fmt.Sprint(thumbnailSize), path, prefix)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return loadThumbnail(prefix + ".jpg")
+}
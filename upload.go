@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// uploadRetries is how many times a failed media upload is tried again,
+// parsed from uploadRetriesValue by applyUploadRetries.
+var (
+	uploadRetries      = 3
+	uploadRetriesValue string
+)
+
+var uploadRetriesSetting = setting{
+	flag:   "upload-retries",
+	env:    "WHATSAPP_UPLOAD_RETRIES",
+	usage:  "retry a failed media upload this many times, waiting longer each time (0 = don't retry)",
+	def:    "3",
+	target: &uploadRetriesValue,
+}
+
+// applyUploadRetries parses --upload-retries. Commands that upload call it
+// after parsing their flags.
+func applyUploadRetries() error {
+	n, err := strconv.Atoi(uploadRetriesValue)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid --upload-retries %q: want a whole number, 0 or more", uploadRetriesValue)
+	}
+	uploadRetries = n
+	return nil
+}
+
+// uploadProgressMin is the size from which uploads report their progress.
+const uploadProgressMin = 1 << 20
+
+// uploadMedia uploads data, retrying failures up to uploadRetries times with
+// a growing, jittered delay. WhatsApp's upload endpoint can't resume a
+// partial upload, so each attempt sends the whole file again.
+func uploadMedia(ctx context.Context, m messenger, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	delay := 2 * time.Second
+	for attempt := 0; ; attempt++ {
+		resp, err := uploadOnce(ctx, m, data, mediaType)
+		if err == nil || ctx.Err() != nil || attempt == uploadRetries {
+			return resp, err
+		}
+
+		wait := delay + time.Duration(rand.Int63n(int64(delay)))
+		fmt.Printf("Upload failed (%v), retrying in %s (%d of %d)\n", err, wait.Round(100*time.Millisecond), attempt+1, uploadRetries)
+		if sleepContext(ctx, wait) != nil {
+			return resp, err
+		}
+		delay = min(delay*2, 30*time.Second)
+	}
+}
+
+// uploadOnce makes one upload attempt. Large files are encrypted into a
+// temporary file, which lets the upload's reads of it report progress.
+func uploadOnce(ctx context.Context, m messenger, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	if len(data) < uploadProgressMin {
+		return m.Upload(ctx, data, mediaType)
+	}
+
+	tmp, err := os.CreateTemp("", "whatsapp-upload-*")
+	if err != nil {
+		return whatsmeow.UploadResponse{}, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	progress := &uploadProgress{File: tmp, total: int64(len(data)), tty: stdoutHasColor()}
+	defer progress.finish()
+	return m.UploadReader(ctx, bytes.NewReader(data), progress, mediaType)
+}
+
+// uploadProgress is the temporary file an upload is encrypted into. whatsmeow
+// writes the ciphertext, seeks back to the start and then sends it, so reads
+// after the seek are the bytes going out.
+type uploadProgress struct {
+	*os.File
+	total int64
+	// tty updates one line in place; otherwise every quarter is printed
+	tty bool
+
+	sending     bool
+	sent        int64
+	lastPrint   time.Time
+	lastQuarter int64
+	printed     bool
+}
+
+func (p *uploadProgress) Seek(offset int64, whence int) (int64, error) {
+	p.sending, p.sent = true, 0
+	return p.File.Seek(offset, whence)
+}
+
+func (p *uploadProgress) Read(b []byte) (int, error) {
+	n, err := p.File.Read(b)
+	if p.sending {
+		p.sent += int64(n)
+		p.report()
+	}
+	return n, err
+}
+
+func (p *uploadProgress) report() {
+	// The ciphertext is padded and has a MAC, so it runs slightly over
+	sent := min(p.sent, p.total)
+	percent := sent * 100 / p.total
+	if p.tty {
+		if time.Since(p.lastPrint) < 200*time.Millisecond && sent < p.total {
+			return
+		}
+		p.lastPrint = time.Now()
+		fmt.Printf("\rUploading: %3d%% (%s of %s) ", percent, formatSize(sent), formatSize(p.total))
+		p.printed = true
+	} else if quarter := percent / 25; quarter > p.lastQuarter {
+		p.lastQuarter = quarter
+		fmt.Printf("Uploading: %d%% (%s of %s)\n", percent, formatSize(sent), formatSize(p.total))
+	}
+}
+
+// finish ends the progress line, so what follows starts on a new one.
+func (p *uploadProgress) finish() {
+	if p.printed {
+		fmt.Println()
+	}
+}
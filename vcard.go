@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// contactCard is one name and phone number to share as a vCard.
+type contactCard struct {
+	name  string
+	phone string // E.164 digits without the leading +
+}
+
+// normalizeE164 strips the usual phone number formatting and checks the
+// result is a plausible E.164 number (country code included, 8-15 digits).
+func normalizeE164(phone string) (string, error) {
+	digits := strings.NewReplacer("+", "", " ", "", "-", "", "(", "", ")", "", ".", "").Replace(phone)
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("invalid phone number %q: use international format with the country code", phone)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("invalid phone number %q: use international format with the country code", phone)
+		}
+	}
+	return digits, nil
+}
+
+// parseContactCards reads name/phone argument pairs.
+func parseContactCards(args []string) ([]contactCard, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, fmt.Errorf("contacts must be given as <name> <phone> pairs")
+	}
+
+	cards := make([]contactCard, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name := strings.TrimSpace(args[i])
+		if name == "" {
+			return nil, fmt.Errorf("contact %d has an empty name", i/2+1)
+		}
+		phone, err := normalizeE164(args[i+1])
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, contactCard{name: name, phone: phone})
+	}
+	return cards, nil
+}
+
+// vcardEscape escapes the characters vCard 3.0 treats specially in text values.
+func vcardEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`).Replace(s)
+}
+
+// vcard renders the card. The waid parameter lets WhatsApp offer to message
+// the number directly.
+func (c contactCard) vcard() string {
+	return "BEGIN:VCARD\n" +
+		"VERSION:3.0\n" +
+		"FN:" + vcardEscape(c.name) + "\n" +
+		"TEL;type=CELL;waid=" + c.phone + ":+" + c.phone + "\n" +
+		"END:VCARD"
+}
+
+func (c contactCard) message() *waE2E.ContactMessage {
+	return &waE2E.ContactMessage{
+		DisplayName: proto.String(c.name),
+		Vcard:       proto.String(c.vcard()),
+	}
+}
+
+// buildContactMessage sends a single card as a ContactMessage and several
+// as a ContactsArrayMessage.
+func buildContactMessage(cards []contactCard) *waE2E.Message {
+	if len(cards) == 1 {
+		return &waE2E.Message{ContactMessage: cards[0].message()}
+	}
+
+	contacts := make([]*waE2E.ContactMessage, len(cards))
+	for i, c := range cards {
+		contacts[i] = c.message()
+	}
+	return &waE2E.Message{ContactsArrayMessage: &waE2E.ContactsArrayMessage{
+		DisplayName: proto.String(fmt.Sprintf("%d contacts", len(cards))),
+		Contacts:    contacts,
+	}}
+}
+
+func sendContact(ctx context.Context, args []string) error {
+	args = parseCommandFlags(newFlagSet("send-contact"), args)
+
+	if len(args) < 3 {
+		fmt.Println("Usage: send-contact <recipient> <name> <phone> [<name> <phone>...]")
+		return errUsage
+	}
+
+	if err := whatsappclient.ValidateRecipient(args[0]); err != nil {
+		return err
+	}
+	cards, err := parseContactCards(args[1:])
+	if err != nil {
+		return err
+	}
+
+	client, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	what := "contact"
+	if len(cards) > 1 {
+		what = "contacts"
+	}
+	return sendAndReport(ctx, client, args[0], buildContactMessage(cards), what)
+}
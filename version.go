@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"go.mau.fi/whatsmeow/store"
+)
+
+// version is the application version, set at build time with
+// -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// whatsmeowModule is the module path looked up in the build info.
+const whatsmeowModule = "go.mau.fi/whatsmeow"
+
+// whatsmeowVersion returns the whatsmeow module version compiled into the
+// binary, or "unknown" if build info isn't available.
+func whatsmeowVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == whatsmeowModule {
+			if dep.Replace != nil {
+				return dep.Replace.Version + " (replaced by " + dep.Replace.Path + ")"
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+func printVersion(args []string) error {
+	parseCommandFlags(newFlagSet("version"), args)
+
+	fmt.Printf("whatsapp-cli %s\n", version)
+	fmt.Printf("Go:               %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("whatsmeow:        %s\n", whatsmeowVersion())
+	fmt.Printf("WhatsApp Web:     %s\n", store.GetWAVersion().String())
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// waveformSamples is how many bars WhatsApp draws for a voice note.
+const waveformSamples = 64
+
+// voiceMimeType is the only format WhatsApp plays as a voice note.
+const voiceMimeType = "audio/ogg; codecs=opus"
+
+// oggOpusInfo is what sending a voice note needs to know about the file.
+type oggOpusInfo struct {
+	duration time.Duration
+	// packetSizes are the byte sizes of the audio packets, in order
+	packetSizes []int
+}
+
+// parseOggOpus walks the Ogg pages of an Ogg Opus file, collecting the size
+// of each audio packet and the duration from the final granule position.
+// There is no Opus decoder here, so the audio itself isn't decoded.
+func parseOggOpus(data []byte) (*oggOpusInfo, error) {
+	var packets [][]byte
+	var partial []byte
+	var lastGranule int64
+
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 27 || !bytes.Equal(data[pos:pos+4], []byte("OggS")) {
+			return nil, fmt.Errorf("not an Ogg file")
+		}
+		granule := int64(binary.LittleEndian.Uint64(data[pos+6:]))
+		segments := int(data[pos+26])
+		tableEnd := pos + 27 + segments
+		if tableEnd > len(data) {
+			return nil, fmt.Errorf("truncated Ogg page")
+		}
+
+		body := tableEnd
+		for _, lacing := range data[pos+27 : tableEnd] {
+			end := body + int(lacing)
+			if end > len(data) {
+				return nil, fmt.Errorf("truncated Ogg page")
+			}
+			partial = append(partial, data[body:end]...)
+			body = end
+			// A lacing value under 255 ends the packet; 255 continues it,
+			// possibly onto the next page
+			if lacing < 255 {
+				packets = append(packets, partial)
+				partial = nil
+			}
+		}
+		// -1 marks a page on which no packet finishes
+		if granule >= 0 {
+			lastGranule = granule
+		}
+		pos = body
+	}
+
+	if len(packets) < 2 || !bytes.HasPrefix(packets[0], []byte("OpusHead")) || len(packets[0]) < 12 {
+		return nil, fmt.Errorf("not an Ogg Opus file")
+	}
+	preSkip := int64(binary.LittleEndian.Uint16(packets[0][10:]))
+
+	info := &oggOpusInfo{}
+	// Granule positions count 48 kHz samples regardless of the input rate
+	if samples := lastGranule - preSkip; samples > 0 {
+		info.duration = time.Duration(samples) * time.Second / 48000
+	}
+	// packets[1] is OpusTags
+	for _, p := range packets[2:] {
+		info.packetSizes = append(info.packetSizes, len(p))
+	}
+	return info, nil
+}
+
+// voiceWaveform builds the 64 waveform bars (0-100) from the audio packet
+// sizes. Opus is variable-bitrate, so louder, busier stretches produce
+// bigger packets and silent ones shrink to a few bytes, which makes packet
+// size a reasonable stand-in for amplitude. Constant-bitrate files carry no
+// such signal and get a placeholder instead of a flat line.
+func voiceWaveform(packetSizes []int) []byte {
+	bars := make([]float64, waveformSamples)
+	if len(packetSizes) > 0 {
+		for i := range bars {
+			start := i * len(packetSizes) / waveformSamples
+			end := max((i+1)*len(packetSizes)/waveformSamples, start+1)
+			end = min(end, len(packetSizes))
+			sum := 0
+			for _, n := range packetSizes[start:end] {
+				sum += n
+			}
+			bars[i] = float64(sum) / float64(end-start)
+		}
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, b := range bars {
+		low, high = math.Min(low, b), math.Max(high, b)
+	}
+	if high-low < 1 {
+		return placeholderWaveform()
+	}
+
+	waveform := make([]byte, waveformSamples)
+	for i, b := range bars {
+		// Keep a minimum height so quiet parts still show as a bar
+		waveform[i] = byte(10 + 90*(b-low)/(high-low))
+	}
+	return waveform
+}
+
+// placeholderWaveform is a speech-like pattern of syllable-sized bumps,
+// used when the audio gives nothing to go on.
+func placeholderWaveform() []byte {
+	waveform := make([]byte, waveformSamples)
+	for i := range waveform {
+		x := float64(i)
+		level := 0.55 + 0.3*math.Sin(x*0.9) + 0.15*math.Sin(x*2.3+1)
+		waveform[i] = byte(10 + 80*math.Max(0, math.Min(1, level)))
+	}
+	return waveform
+}
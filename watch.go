@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// messageFilter limits the listener to messages from some senders, in some
+// chats or of some types. Empty lists don't filter; a message must pass all.
+type messageFilter struct {
+	fromFlags, chatFlags repeatedFlag
+	from, chats          []types.JID
+	typeFlag             string
+	types                []string
+}
+
+func (f *messageFilter) register(fs *flag.FlagSet) {
+	fs.Var(&f.fromFlags, "from", "only handle messages sent by this phone number or JID (repeatable)")
+	fs.Var(&f.chatFlags, "chat", "only handle messages in this chat, by phone number or group JID (repeatable)")
+	fs.StringVar(&f.typeFlag, "filter-type", "", "only handle messages of these comma-separated types, e.g. image,video,document")
+}
+
+func (f *messageFilter) validate() error {
+	for _, s := range f.fromFlags {
+		jid, err := whatsappclient.ParseRecipient(s)
+		if err != nil {
+			return err
+		}
+		f.from = append(f.from, jid.ToNonAD())
+	}
+	for _, s := range f.chatFlags {
+		jid, err := whatsappclient.ParseRecipient(s)
+		if err != nil {
+			return err
+		}
+		f.chats = append(f.chats, jid.ToNonAD())
+	}
+	for _, t := range strings.Split(f.typeFlag, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if !slices.Contains(whatsappclient.MessageTypes, t) {
+			return fmt.Errorf("unknown --filter-type %q (valid types: %s)", t, strings.Join(whatsappclient.MessageTypes, ", "))
+		}
+		f.types = append(f.types, t)
+	}
+	return nil
+}
+
+// match reports whether msg passes the filter. The sender's device is
+// ignored, so --from matches every device of an account.
+func (f *messageFilter) match(msg whatsappclient.Event) bool {
+	if len(f.from) > 0 && !slices.Contains(f.from, msg.Sender.ToNonAD()) {
+		return false
+	}
+	if len(f.chats) > 0 && !slices.Contains(f.chats, msg.Chat.ToNonAD()) {
+		return false
+	}
+	if len(f.types) > 0 && !slices.Contains(f.types, msg.Type) {
+		return false
+	}
+	return true
+}
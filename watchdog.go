@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-qr/whatsappclient"
+)
+
+// connectionWatchdog reconnects the listener when nothing has been received
+// for a while and the server doesn't answer a ping either, which catches
+// half-open websockets that whatsmeow still considers connected. Successful
+// keepalives emit no event, so a quiet account is only idle, not stale,
+// until the ping fails.
+type connectionWatchdog struct {
+	timeout time.Duration
+
+	lock         sync.Mutex
+	lastActivity time.Time
+}
+
+func newConnectionWatchdog(timeout time.Duration) *connectionWatchdog {
+	return &connectionWatchdog{timeout: timeout, lastActivity: time.Now()}
+}
+
+// handleEvent is registered as a client event handler. Any event except a
+// keepalive failure counts as activity.
+func (w *connectionWatchdog) handleEvent(evt interface{}) {
+	if _, ok := evt.(*events.KeepAliveTimeout); ok {
+		return
+	}
+	w.touch()
+}
+
+func (w *connectionWatchdog) touch() {
+	w.lock.Lock()
+	w.lastActivity = time.Now()
+	w.lock.Unlock()
+}
+
+func (w *connectionWatchdog) idle() time.Duration {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return time.Since(w.lastActivity)
+}
+
+// watchdogClient is the part of the client the watchdog uses.
+type watchdogClient interface {
+	Ping(ctx context.Context) error
+	Connect() error
+	Disconnect()
+}
+
+var _ watchdogClient = (*whatsappclient.Client)(nil)
+
+// run checks for a stale connection until ctx is cancelled.
+func (w *connectionWatchdog) run(ctx context.Context, client watchdogClient) {
+	ticker := time.NewTicker(max(min(w.timeout/4, 30*time.Second), time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		idle := w.idle()
+		if idle < w.timeout {
+			continue
+		}
+		err := client.Ping(ctx)
+		if err == nil {
+			w.touch()
+			continue
+		} else if ctx.Err() != nil {
+			return
+		}
+
+		fmt.Printf("No activity for %s and the server didn't answer a ping (%v), reconnecting...\n", idle.Round(time.Second), err)
+		client.Disconnect()
+		if err := client.Connect(); err != nil {
+			fmt.Printf("Error reconnecting: %v\n", err)
+		}
+		// Give the new connection a full interval before checking again
+		w.touch()
+	}
+}
+
+// printKeepAliveEvent prints keepalive failures and recoveries.
+func printKeepAliveEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.KeepAliveTimeout:
+		fmt.Printf("[KeepAlive] Timed out (%d failures, last success %s)\n", v.ErrorCount, v.LastSuccess.Local().Format("2006-01-02 15:04:05"))
+	case *events.KeepAliveRestored:
+		fmt.Println("[KeepAlive] Restored")
+	}
+}
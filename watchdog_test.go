@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pingClient answers the watchdog's pings with pingErr and counts
+// reconnects.
+type pingClient struct {
+	pingErr error
+
+	lock       sync.Mutex
+	pings      int
+	reconnects int
+}
+
+func (c *pingClient) Ping(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pings++
+	return c.pingErr
+}
+
+func (c *pingClient) Connect() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reconnects++
+	return nil
+}
+
+func (c *pingClient) Disconnect() {}
+
+func TestWatchdogPingsBeforeReconnecting(t *testing.T) {
+	alive := &pingClient{}
+	dead := &pingClient{pingErr: errors.New("timed out")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, client := range []*pingClient{alive, dead} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			newConnectionWatchdog(time.Millisecond).run(ctx, client)
+		}()
+	}
+	wg.Wait()
+
+	if alive.pings == 0 || alive.reconnects != 0 {
+		t.Errorf("idle but answering connection: %d pings, %d reconnects, want pings and no reconnect", alive.pings, alive.reconnects)
+	}
+	if dead.reconnects == 0 {
+		t.Errorf("connection not answering pings was not reconnected")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// webhookURL receives a JSON POST for every message the listener prints.
+var webhookURL string
+
+var webhookSetting = setting{
+	flag:   "webhook",
+	env:    "WHATSAPP_WEBHOOK_URL",
+	usage:  "POST each received message as JSON to this URL",
+	target: &webhookURL,
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// postWebhook sends payload to url as JSON. Failures are printed rather than
+// returned, since the listener keeps running regardless.
+func postWebhook(url string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("Webhook error: %v\n", err)
+		return
+	}
+
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("Webhook error: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		fmt.Printf("Webhook error: %s returned %s\n", url, resp.Status)
+	}
+}
+
+// stateWebhookURL receives a JSON POST whenever the listener's connection
+// state changes, separately from the message webhook.
+var stateWebhookURL string
+
+var stateWebhookSetting = setting{
+	flag:   "state-webhook",
+	env:    "WHATSAPP_STATE_WEBHOOK_URL",
+	usage:  "POST connection state changes (connected, disconnected, logged_out, stream_replaced) as JSON to this URL",
+	target: &stateWebhookURL,
+}
+
+// stateChange is the state webhook payload.
+type stateChange struct {
+	Event     string    `json:"event"`
+	JID       string    `json:"jid,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// stateWebhook posts connection lifecycle events for an external monitor,
+// e.g. to page someone when another login replaces the session.
+type stateWebhook struct {
+	url string
+	jid string
+}
+
+func (w *stateWebhook) handleEvent(evt interface{}) {
+	change := stateChange{JID: w.jid, Timestamp: time.Now()}
+	switch v := evt.(type) {
+	case *events.Connected:
+		change.Event = "connected"
+	case *events.Disconnected:
+		change.Event = "disconnected"
+	case *events.LoggedOut:
+		change.Event = "logged_out"
+		if v.OnConnect {
+			change.Reason = v.Reason.String()
+		}
+	case *events.StreamReplaced:
+		change.Event = "stream_replaced"
+	default:
+		return
+	}
+	go postWebhook(w.url, change)
+}
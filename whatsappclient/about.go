@@ -0,0 +1,81 @@
+package whatsappclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// About is a user's "about" text.
+type About struct {
+	Text string
+	// SetAt is when the text was last changed, if WhatsApp said
+	SetAt time.Time
+	// Hidden is set when the user's privacy settings keep it from us
+	Hidden bool
+}
+
+// GetAbout fetches the about text of several users in one query.
+// GetUserInfo asks for the same thing but drops the timestamp and the
+// privacy error, so this sends the status-only usync query itself. Users
+// WhatsApp doesn't know are missing from the result.
+func (c *Client) GetAbout(ctx context.Context, jids []types.JID) (map[types.JID]About, error) {
+	users := make([]waBinary.Node, len(jids))
+	for i, jid := range jids {
+		users[i] = waBinary.Node{Tag: "user", Attrs: waBinary.Attrs{"jid": jid.ToNonAD()}}
+	}
+	resp, err := c.DangerousInternals().SendIQ(whatsmeow.DangerousInfoQuery{
+		Context:   ctx,
+		Namespace: "usync",
+		Type:      "get",
+		To:        types.ServerJID,
+		Content: []waBinary.Node{{
+			Tag: "usync",
+			Attrs: waBinary.Attrs{
+				"sid":     c.GenerateMessageID(),
+				"mode":    "full",
+				"last":    "true",
+				"index":   "0",
+				"context": "background",
+			},
+			Content: []waBinary.Node{
+				{Tag: "query", Content: []waBinary.Node{{Tag: "status"}}},
+				{Tag: "list", Content: users},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query about: %v", err)
+	}
+	list, ok := resp.GetOptionalChildByTag("usync", "list")
+	if !ok {
+		return nil, fmt.Errorf("response to about query has no user list")
+	}
+
+	result := make(map[types.JID]About, len(jids))
+	for _, child := range list.GetChildren() {
+		jid, ok := child.Attrs["jid"].(types.JID)
+		if child.Tag != "user" || !ok {
+			continue
+		}
+		status, ok := child.GetOptionalChildByTag("status")
+		if !ok {
+			continue
+		}
+		var about About
+		text, _ := status.Content.([]byte)
+		about.Text = string(text)
+		ag := status.AttrGetter()
+		about.SetAt = ag.OptionalUnixTime("t")
+		// 401 and 403 mean the about is only shared with others
+		if code := ag.OptionalInt("code"); code == 401 || code == 403 {
+			about.Hidden = true
+		}
+		result[jid] = about
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package whatsappclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// DefaultBackupDir is where backups of the database at dbPath go when
+// Options.BackupDir is empty: a backups directory beside it.
+func DefaultBackupDir(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), "backups")
+}
+
+// BackupDB copies the SQLite database at dbPath into dir as
+// <name>-<timestamp>.db and returns the backup's path. In WAL mode recent
+// writes may still be in the -wal file, so that is copied alongside. The
+// files are copied byte for byte rather than through SQLite, so a database
+// too damaged to open can still be backed up.
+func BackupDB(dbPath, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(dbPath), filepath.Ext(dbPath))
+	stamp := time.Now().Format("20060102-150405")
+	backup := filepath.Join(dir, fmt.Sprintf("%s-%s.db", name, stamp))
+	for i := 2; fileExists(backup); i++ {
+		backup = filepath.Join(dir, fmt.Sprintf("%s-%s-%d.db", name, stamp, i))
+	}
+
+	if err := copyFile(dbPath, backup); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %v", dbPath, err)
+	}
+	if err := copyFile(dbPath+"-wal", backup+"-wal"); err != nil && !os.IsNotExist(err) {
+		os.Remove(backup)
+		return "", fmt.Errorf("failed to back up %s-wal: %v", dbPath, err)
+	}
+	return backup, nil
+}
+
+// RestoreDB replaces the database at dbPath with a backup made by BackupDB.
+// Nothing may have the database open while it runs.
+func RestoreDB(backup, dbPath string) error {
+	f, err := os.Open(backup)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(f, header)
+	f.Close()
+	if err != nil || !bytes.Equal(header, sqliteHeader) {
+		return fmt.Errorf("%s is not a SQLite database", backup)
+	}
+
+	// The current WAL and shared-memory files belong to the database being
+	// replaced and would be replayed over the backup
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s%s: %v", dbPath, suffix, err)
+		}
+	}
+	if err := copyFile(backup, dbPath); err != nil {
+		return fmt.Errorf("failed to restore %s: %v", dbPath, err)
+	}
+	if err := copyFile(backup+"-wal", dbPath+"-wal"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to restore %s-wal: %v", dbPath, err)
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// copyFile copies src to dst through a temporary file, so dst is never left
+// half written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
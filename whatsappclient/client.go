@@ -0,0 +1,410 @@
+// Package whatsappclient wraps a whatsmeow client backed by a local SQLite
+// session store, so the CLI's connection and message handling can be embedded
+// in other Go programs.
+package whatsappclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCompanionReg"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultDBName is the session database file used when Options.DBPath is empty.
+const DefaultDBName = "whatsapp.db"
+
+// Options configures a Client.
+type Options struct {
+	// DBPath is the SQLite session database. Defaults to DefaultDBName in the
+	// working directory.
+	DBPath string
+	// LogLevel is the whatsmeow log level (DEBUG, INFO, WARN, ERROR).
+	// Defaults to DEBUG.
+	LogLevel string
+	// MessageBuffer is the capacity of the Messages channel. Defaults to 100.
+	MessageBuffer int
+	// DeviceName is shown for this device in the phone's linked-devices
+	// list. It only takes effect when pairing. Defaults to "whatsmeow".
+	DeviceName string
+	// SessionJID selects which paired device to use when the database holds
+	// several. Defaults to the first one.
+	SessionJID string
+	// PreferredSessionJID is used like SessionJID when that is empty, but
+	// falls back to the first device if the session no longer exists.
+	PreferredSessionJID string
+	// NewDevice makes New return a new, unpaired device to log in with, so
+	// another account can be added beside the sessions already stored. It
+	// is ignored when SessionJID is set.
+	NewDevice bool
+	// DevicePlatform selects the icon shown in the linked-devices list, as a
+	// waCompanionReg.DeviceProps_PlatformType name (e.g. CHROME, DESKTOP).
+	// It only takes effect when pairing.
+	DevicePlatform string
+	// RecipientCacheTTL is how long phone number lookups are cached.
+	// Defaults to DefaultRecipientCacheTTL.
+	RecipientCacheTTL time.Duration
+	// NoRecipientCache makes every phone number lookup query WhatsApp.
+	NoRecipientCache bool
+	// Proxy routes the websocket and media transfers through an http://,
+	// https:// or socks5:// proxy URL.
+	Proxy string
+	// DB overrides the SQLite pragmas of the session database.
+	DB DBOptions
+	// BackupDir receives a copy of the session database before New deletes
+	// it as corrupted. Defaults to DefaultBackupDir.
+	BackupDir string
+}
+
+// Client is a whatsmeow client with a message channel on top. The embedded
+// *whatsmeow.Client is available for anything not wrapped here.
+type Client struct {
+	*whatsmeow.Client
+
+	// DBPath is the resolved path of the session database.
+	DBPath string
+	// Registered reports whether the database already held a paired device
+	// when the client was created. If false, the client has a fresh device
+	// that must be paired with a QR code before it can connect.
+	Registered bool
+	// Proxy is the proxy URL from Options, with any password redacted.
+	Proxy string
+
+	log           waLog.Logger
+	handlerID     uint32
+	lock          sync.Mutex
+	messageBuffer int
+	messages      chan Event
+	closed        bool
+	cacheTTL      time.Duration
+	noCache       bool
+	cache         *recipientCache
+	dbOpts        DBOptions
+	container     *sqlstore.Container
+	backupDir     string
+	proxyURL      *url.URL
+	ownsLockFile  bool
+}
+
+// DBOptions overrides the SQLite driver and pragmas the session database is
+// opened with. The zero value keeps the defaults, which suit a local disk.
+type DBOptions struct {
+	// Driver is DriverModernc (the default) or DriverMattn.
+	Driver string
+	// JournalMode is the journal_mode pragma. Defaults to WAL for better
+	// concurrency; DELETE or TRUNCATE avoid WAL's shared-memory file on
+	// network filesystems such as NFS.
+	JournalMode string
+	// CacheSize is the cache_size pragma: pages if positive, KiB if
+	// negative. Defaults to -2000 (2 MB).
+	CacheSize int
+	// BusyTimeout is how long to wait when the database is locked.
+	// Defaults to 5 seconds.
+	BusyTimeout time.Duration
+}
+
+// journalModes are the values SQLite accepts for journal_mode.
+var journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
+// Validate checks Driver, JournalMode and BusyTimeout.
+func (o DBOptions) Validate() error {
+	if err := o.validateDriver(); err != nil {
+		return err
+	}
+	if o.JournalMode != "" && !slices.Contains(journalModes, strings.ToUpper(o.JournalMode)) {
+		return fmt.Errorf("invalid journal mode %q (want one of %s)", o.JournalMode, strings.Join(journalModes, ", "))
+	}
+	if o.BusyTimeout < 0 {
+		return fmt.Errorf("busy timeout must not be negative")
+	}
+	return nil
+}
+
+// ResolveDBPath returns the session database path New will use for path,
+// which defaults to DefaultDBName in the working directory.
+func ResolveDBPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %v", err)
+	}
+	return filepath.Join(dir, DefaultDBName), nil
+}
+
+// New opens the session database and creates a client for the first device
+// stored in it. It does not connect.
+func New(opts Options) (*Client, error) {
+	if opts.LogLevel == "" {
+		opts.LogLevel = "DEBUG"
+	}
+	if opts.MessageBuffer <= 0 {
+		opts.MessageBuffer = 100
+	}
+	if opts.RecipientCacheTTL <= 0 {
+		opts.RecipientCacheTTL = DefaultRecipientCacheTTL
+	}
+	proxyURL, err := ParseProxy(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Device props are sent in the pairing payload, so set them before the
+	// client exists
+	if opts.DeviceName != "" {
+		store.DeviceProps.Os = proto.String(opts.DeviceName)
+	}
+	if opts.DevicePlatform != "" {
+		platform, ok := waCompanionReg.DeviceProps_PlatformType_value[strings.ToUpper(opts.DevicePlatform)]
+		if !ok {
+			return nil, fmt.Errorf("unknown device platform %q", opts.DevicePlatform)
+		}
+		store.DeviceProps.PlatformType = waCompanionReg.DeviceProps_PlatformType(platform).Enum()
+	}
+
+	logger := waLog.Stdout("Main", opts.LogLevel, true)
+	dbLog := waLog.Stdout("Database", opts.LogLevel, true)
+
+	dbPath, err := ResolveDBPath(opts.DBPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Opening runs the schema upgrade, which needs a write lock and so is
+	// where a second instance usually collides with the first
+	var container *sqlstore.Container
+	err = retryLocked(func() (err error) {
+		if err := opts.DB.selfTest(dbPath, logger); err != nil {
+			return err
+		}
+		container, err = sqlstore.New(opts.DB.DriverName(), opts.DB.DSN(dbPath), dbLog)
+		return err
+	})
+	if err != nil {
+		if IsCorrupt(err) {
+			// Deleting the database logs the session out, so keep a copy and
+			// give up if that isn't possible
+			backupDir := opts.BackupDir
+			if backupDir == "" {
+				backupDir = DefaultBackupDir(dbPath)
+			}
+			backup, backupErr := BackupDB(dbPath, backupDir)
+			if backupErr != nil {
+				return nil, fmt.Errorf("database appears to be corrupted and could not be backed up before recreating it: %v", backupErr)
+			}
+			logger.Warnf("Database appears to be corrupted (%v), backed it up to %s; removing and creating new one...", err, backup)
+			// A journal left beside the new database would be replayed into it
+			for _, suffix := range []string{"", "-wal", "-shm"} {
+				os.Remove(dbPath + suffix)
+			}
+			container, err = sqlstore.New(opts.DB.DriverName(), opts.DB.DSN(dbPath), dbLog)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to database: %v", err)
+			}
+		} else {
+			return nil, fmt.Errorf("failed to connect to database: %v", lockedError(dbPath, err))
+		}
+	}
+
+	var deviceStore *store.Device
+	if opts.SessionJID != "" {
+		jid, err := types.ParseJID(opts.SessionJID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session JID %q: %v", opts.SessionJID, err)
+		}
+		err = retryLocked(func() (err error) {
+			deviceStore, err = container.GetDevice(jid)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load session %s: %v", jid, lockedError(dbPath, err))
+		}
+		if deviceStore == nil {
+			return nil, fmt.Errorf("no session for %s in %s", jid, dbPath)
+		}
+	} else if opts.NewDevice {
+		deviceStore = container.NewDevice()
+	} else if opts.PreferredSessionJID != "" {
+		// A preferred session that was logged out since is no reason to
+		// fail, but a database that can't be read is
+		if jid, err := types.ParseJID(opts.PreferredSessionJID); err == nil {
+			err = retryLocked(func() (err error) {
+				deviceStore, err = container.GetDevice(jid)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to load session %s: %v", jid, lockedError(dbPath, err))
+			}
+		}
+	}
+	if deviceStore == nil {
+		// GetFirstDevice hands back a new, unpaired device when the store is
+		// empty, so an error means the query itself failed and a nil ID is
+		// what tells "not logged in yet" apart
+		err = retryLocked(func() (err error) {
+			deviceStore, err = container.GetFirstDevice()
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load device from %s: %v", dbPath, lockedError(dbPath, err))
+		}
+		if deviceStore == nil {
+			return nil, fmt.Errorf("failed to create device: device store is nil")
+		}
+	}
+
+	c := &Client{
+		Client:        whatsmeow.NewClient(deviceStore, logger),
+		DBPath:        dbPath,
+		Registered:    deviceStore.ID != nil,
+		log:           logger,
+		messageBuffer: opts.MessageBuffer,
+		cacheTTL:      opts.RecipientCacheTTL,
+		noCache:       opts.NoRecipientCache,
+		dbOpts:        opts.DB,
+		container:     container,
+		backupDir:     opts.BackupDir,
+		ownsLockFile:  claimLockFile(dbPath),
+	}
+	if c.backupDir == "" {
+		c.backupDir = DefaultBackupDir(dbPath)
+	}
+	if proxyURL != nil {
+		if err := c.SetProxyAddress(proxyURL.String()); err != nil {
+			return nil, fmt.Errorf("invalid proxy %s: %v", proxyURL.Redacted(), err)
+		}
+		c.Proxy = proxyURL.Redacted()
+		c.proxyURL = proxyURL
+	}
+	c.handlerID = c.AddEventHandler(c.handleEvent)
+
+	return c, nil
+}
+
+// ParseProxy validates a proxy URL for Options.Proxy. It returns nil for an
+// empty string.
+func ParseProxy(proxy string) (*url.URL, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https or socks5)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", proxy)
+	}
+	return u, nil
+}
+
+func (c *Client) handleEvent(evt interface{}) {
+	msg, ok := evt.(*events.Message)
+	if !ok {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed || c.messages == nil {
+		return
+	}
+
+	// Never block whatsmeow's event loop on a slow consumer
+	select {
+	case c.messages <- NewEvent(msg):
+	default:
+		c.log.Warnf("Message channel full, dropping message %s", msg.Info.ID)
+	}
+}
+
+// IsPaired reports whether the client currently has a device ID, i.e. it has
+// been paired with a phone either before New or by a QR login since.
+func (c *Client) IsPaired() bool {
+	return c.Store.ID != nil
+}
+
+// Messages returns a channel of received messages. Messages are only
+// queued once this has been called, and the channel is closed by Close.
+func (c *Client) Messages() <-chan Event {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.messages == nil {
+		c.messages = make(chan Event, c.messageBuffer)
+		if c.closed {
+			close(c.messages)
+		}
+	}
+	return c.messages
+}
+
+// Send resolves recipient (a phone number, JID, or "me") and sends msg to it.
+func (c *Client) Send(ctx context.Context, recipient string, msg *waE2E.Message) (whatsmeow.SendResponse, error) {
+	jid, err := c.ResolveRecipient(recipient)
+	if err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+	return c.SendMessage(ctx, jid, msg)
+}
+
+// Sessions returns the JIDs of every logged-in device in the database.
+func (c *Client) Sessions() ([]types.JID, error) {
+	var devices []*store.Device
+	err := retryLocked(func() (err error) {
+		devices, err = c.container.GetAllDevices()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", lockedError(c.DBPath, err))
+	}
+	jids := make([]types.JID, 0, len(devices))
+	for _, device := range devices {
+		if device.ID != nil {
+			jids = append(jids, *device.ID)
+		}
+	}
+	return jids, nil
+}
+
+// Close disconnects the client and closes the Messages channel.
+func (c *Client) Close() {
+	c.RemoveEventHandler(c.handlerID)
+	c.Disconnect()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.closed {
+		c.closed = true
+		if c.messages != nil {
+			close(c.messages)
+		}
+		if c.cache != nil {
+			c.cache.db.Close()
+		}
+		if c.ownsLockFile {
+			releaseLockFile(c.DBPath)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package whatsappclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// clockCheckURL is asked for the time. Its Date header comes from the same
+// servers as the websocket.
+const clockCheckURL = "https://web.whatsapp.com/"
+
+// ClockSkew estimates how far the local clock is from WhatsApp's, positive
+// when the local clock is ahead. It reads the Date header of an HTTPS
+// request through the client's proxy, so it is only accurate to about a
+// second. The websocket handshake carries the server time too, but whatsmeow
+// doesn't expose it.
+func (c *Client) ClockSkew(ctx context.Context) (time.Duration, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(c.proxyURL)
+	}
+	httpClient := &http.Client{Transport: transport}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, clockCheckURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch server time: %v", err)
+	}
+	resp.Body.Close()
+	end := time.Now()
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("server sent no usable Date header: %v", err)
+	}
+	// The header was generated some time during the round trip; the
+	// midpoint is the best guess, and the header drops the fraction of a
+	// second
+	local := start.Add(end.Sub(start) / 2)
+	return local.Sub(serverTime.Add(500 * time.Millisecond)), nil
+}
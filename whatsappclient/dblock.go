@@ -0,0 +1,136 @@
+package whatsappclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockRetries is how many more times a store operation is tried after
+// SQLite reports the database locked, on top of busy_timeout's own wait.
+const lockRetries = 4
+
+// IsLocked reports whether err is SQLite giving up on a database another
+// connection holds locked.
+func IsLocked(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "SQLITE_BUSY")
+}
+
+// IsCorrupt reports whether err is SQLite finding the database damaged
+// (SQLITE_CORRUPT) or not a database at all (SQLITE_NOTADB).
+func IsCorrupt(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database disk image is malformed") || strings.Contains(msg, "file is not a database") ||
+		strings.Contains(msg, "SQLITE_CORRUPT") || strings.Contains(msg, "SQLITE_NOTADB")
+}
+
+// retryLocked runs fn again with a growing, jittered delay while it fails
+// with a lock error, so two commands started together don't keep colliding.
+func retryLocked(fn func() error) error {
+	delay := 200 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if !IsLocked(err) || attempt == lockRetries {
+			return err
+		}
+		time.Sleep(delay + time.Duration(rand.Int63n(int64(delay))))
+		delay *= 2
+	}
+}
+
+// dbHolder is the advisory lock file written beside the session database,
+// naming the process using it. It doesn't keep anyone out, since several
+// commands may share a database; it only lets a lock error say who to stop.
+type dbHolder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+func lockFilePath(dbPath string) string {
+	return dbPath + ".lock"
+}
+
+// claimLockFile records this process in the lock file unless a running
+// process already has. It returns whether the file is now ours.
+func claimLockFile(dbPath string) bool {
+	path := lockFilePath(dbPath)
+	if holder := readLockFile(dbPath); holder != nil && holder.PID != os.Getpid() && processAlive(holder.PID) {
+		return false
+	}
+	data, err := json.Marshal(dbHolder{
+		PID:     os.Getpid(),
+		Command: strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:2]...), " "),
+		Since:   time.Now(),
+	})
+	if err != nil {
+		return false
+	}
+	return os.WriteFile(path, data, 0600) == nil
+}
+
+func readLockFile(dbPath string) *dbHolder {
+	data, err := os.ReadFile(lockFilePath(dbPath))
+	if err != nil {
+		return nil
+	}
+	var holder dbHolder
+	if json.Unmarshal(data, &holder) != nil || holder.PID == 0 {
+		return nil
+	}
+	return &holder
+}
+
+// releaseLockFile removes the lock file if it still names this process.
+func releaseLockFile(dbPath string) {
+	if holder := readLockFile(dbPath); holder != nil && holder.PID == os.Getpid() {
+		os.Remove(lockFilePath(dbPath))
+	}
+}
+
+// processAlive reports whether pid is running. Windows can't be sent signal
+// 0, but there FindProcess already fails for a process that has exited.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+// lockedError explains a lock error that outlasted the retries, naming the
+// other instance when the lock file says which it is.
+func lockedError(dbPath string, err error) error {
+	if !IsLocked(err) {
+		return err
+	}
+	if holder := readLockFile(dbPath); holder != nil && holder.PID != os.Getpid() && processAlive(holder.PID) {
+		return fmt.Errorf("another instance is using this session DB (%s, pid %d, running since %s); stop it or use a different --db-path: %v",
+			holder.Command, holder.PID, holder.Since.Local().Format("2006-01-02 15:04:05"), err)
+	}
+	return fmt.Errorf("another process is using this session DB %s; stop it or use a different --db-path: %v", dbPath, err)
+}
+
+// SaveStore saves the device store like Store.Save, retrying while another
+// instance holds the database locked.
+func (c *Client) SaveStore() error {
+	return lockedError(c.DBPath, retryLocked(c.Store.Save))
+}
@@ -0,0 +1,72 @@
+package whatsappclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ErrPrimaryDevice is returned by RemoveLinkedDevice for device 0, the
+// phone the account lives on, which can't be unlinked.
+var ErrPrimaryDevice = errors.New("device 0 is the primary phone, which can't be unlinked")
+
+// LinkedDevices returns every device of the logged-in account, the primary
+// phone (device 0) first. It needs a connection.
+func (c *Client) LinkedDevices(ctx context.Context) ([]types.JID, error) {
+	if c.Store.ID == nil {
+		return nil, fmt.Errorf("not logged in")
+	}
+	devices, err := c.GetUserDevicesContext(ctx, []types.JID{c.Store.ID.ToNonAD()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get linked devices: %v", err)
+	}
+	slices.SortFunc(devices, func(a, b types.JID) int {
+		return int(a.Device) - int(b.Device)
+	})
+	return devices, nil
+}
+
+// RemoveLinkedDevice unlinks a companion device of the account. For this
+// device it logs out, which also clears the session from the store, so the
+// database is backed up first and nothing is removed if that fails. Other
+// companions are removed with the request the phone's linked-devices
+// screen sends; WhatsApp may only accept that from the primary phone.
+func (c *Client) RemoveLinkedDevice(ctx context.Context, device types.JID) error {
+	if c.Store.ID == nil {
+		return fmt.Errorf("not logged in")
+	}
+	if device.User != c.Store.ID.User {
+		return fmt.Errorf("%s is not a device of this account", device.String())
+	}
+	if device.Device == 0 {
+		return ErrPrimaryDevice
+	}
+	if device.Device == c.Store.ID.Device {
+		backup, err := BackupDB(c.DBPath, c.backupDir)
+		if err != nil {
+			return fmt.Errorf("not logging out, the session could not be backed up first: %v", err)
+		}
+		c.log.Infof("Backed up %s to %s before logging out", c.DBPath, backup)
+		return c.Logout()
+	}
+
+	_, err := c.DangerousInternals().SendIQ(whatsmeow.DangerousInfoQuery{
+		Context:   ctx,
+		Namespace: "md",
+		Type:      "set",
+		To:        types.ServerJID,
+		Content: []waBinary.Node{{
+			Tag:   "remove-companion-device",
+			Attrs: waBinary.Attrs{"jid": device, "reason": "user_initiated"},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unlink %s: %v", device.String(), err)
+	}
+	return nil
+}
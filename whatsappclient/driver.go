@@ -0,0 +1,146 @@
+package whatsappclient
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+	_ "modernc.org/sqlite"
+)
+
+// SQLite drivers DBOptions.Driver can select.
+const (
+	// DriverModernc is the pure-Go modernc.org/sqlite, always built in.
+	DriverModernc = "modernc"
+	// DriverMattn is the cgo github.com/mattn/go-sqlite3, built in only
+	// with the sqlite_mattn build tag.
+	DriverMattn = "mattn"
+)
+
+// driverNames maps Driver values to the database/sql driver names, which
+// are also the dialects sqlstore expects.
+var driverNames = map[string]string{
+	DriverModernc: "sqlite",
+	DriverMattn:   "sqlite3",
+}
+
+func (o DBOptions) driver() string {
+	if o.Driver == "" {
+		return DriverModernc
+	}
+	return strings.ToLower(o.Driver)
+}
+
+// DriverName returns the database/sql driver name to open the database with.
+func (o DBOptions) DriverName() string {
+	return driverNames[o.driver()]
+}
+
+// validateDriver checks Driver names a driver compiled into this binary.
+func (o DBOptions) validateDriver() error {
+	name, ok := driverNames[o.driver()]
+	if !ok {
+		return fmt.Errorf("unknown SQLite driver %q (want %s or %s)", o.Driver, DriverModernc, DriverMattn)
+	}
+	if !slices.Contains(sql.Drivers(), name) {
+		return fmt.Errorf("the %s SQLite driver isn't built into this binary; rebuild with go build -tags \"sqlite_mattn sqlite_fts5\" (needs cgo and a C compiler)", o.driver())
+	}
+	return nil
+}
+
+// Open opens the SQLite database at path with the selected driver and the
+// pragmas from DSN.
+func (o DBOptions) Open(path string) (*sql.DB, error) {
+	return sql.Open(o.DriverName(), o.DSN(path))
+}
+
+// pragmas returns the journal mode, cache size and busy timeout to apply.
+func (o DBOptions) pragmas() (journalMode string, cacheSize int, busyTimeout time.Duration) {
+	journalMode, cacheSize, busyTimeout = "WAL", -2000, 5*time.Second
+	if o.JournalMode != "" {
+		journalMode = strings.ToUpper(o.JournalMode)
+	}
+	if o.CacheSize != 0 {
+		cacheSize = o.CacheSize
+	}
+	if o.BusyTimeout > 0 {
+		busyTimeout = o.BusyTimeout
+	}
+	return journalMode, cacheSize, busyTimeout
+}
+
+// DSN returns the database/sql data source name for the SQLite database at
+// path, with the pragmas the session store relies on. The drivers spell
+// them differently: modernc takes _pragma=name(value), mattn its own
+// _name=value parameters.
+func (o DBOptions) DSN(path string) string {
+	journalMode, cacheSize, busyTimeout := o.pragmas()
+	timeout := strconv.FormatInt(busyTimeout.Milliseconds(), 10)
+
+	if o.driver() == DriverMattn {
+		return "file:" + path + "?_foreign_keys=on" +
+			"&_journal_mode=" + journalMode +
+			"&_synchronous=NORMAL" +
+			"&_busy_timeout=" + timeout +
+			"&_cache_size=" + strconv.Itoa(cacheSize)
+	}
+	return "file:" + path + "?_foreign_keys=on" +
+		"&_pragma=foreign_keys(1)" +
+		"&_pragma=journal_mode(" + journalMode + ")" +
+		"&_pragma=synchronous(NORMAL)" + // Slightly faster, still safe
+		"&_pragma=busy_timeout(" + timeout + ")" +
+		"&_pragma=cache_size(" + strconv.Itoa(cacheSize) + ")"
+}
+
+// DSN is DBOptions.DSN with the default pragmas.
+func DSN(path string) string {
+	return DBOptions{}.DSN(path)
+}
+
+// selfTest opens the database at path and checks the DSN's pragmas took
+// effect. A driver that rejects or ignores them otherwise surfaces later as
+// sqlstore's bare "foreign keys are not enabled". Lock and corruption
+// errors are returned as they are, for New to retry or recover from. A
+// journal mode that didn't stick, e.g. WAL on a filesystem without shared
+// memory, only slows things down and is logged.
+func (o DBOptions) selfTest(path string, log waLog.Logger) error {
+	journalMode, cacheSize, busyTimeout := o.pragmas()
+	db, err := o.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open database with the %s SQLite driver: %v", o.driver(), err)
+	}
+	defer db.Close()
+
+	var foreignKeys bool
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		if IsLocked(err) || IsCorrupt(err) {
+			return err
+		}
+		return fmt.Errorf("the %s SQLite driver failed to open the database with pragmas journal_mode=%s, cache_size=%d, busy_timeout=%s (check --db-journal-mode and --db-cache-size, or try --db-driver %s): %v",
+			o.driver(), journalMode, cacheSize, busyTimeout, otherDriver(o.driver()), err)
+	}
+	if !foreignKeys {
+		return fmt.Errorf("the %s SQLite driver ignored the foreign_keys pragma, which the session store needs; try --db-driver %s", o.driver(), otherDriver(o.driver()))
+	}
+
+	var actual string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&actual); err != nil {
+		return fmt.Errorf("failed to check journal mode: %v", err)
+	}
+	if !strings.EqualFold(actual, journalMode) {
+		log.Warnf("Database journal mode is %s instead of %s; the driver or filesystem doesn't support it (--db-journal-mode %s silences this)",
+			strings.ToUpper(actual), journalMode, strings.ToUpper(actual))
+	}
+	return nil
+}
+
+func otherDriver(driver string) string {
+	if driver == DriverMattn {
+		return DriverModernc
+	}
+	return DriverMattn
+}
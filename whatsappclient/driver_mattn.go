@@ -0,0 +1,12 @@
+//go:build sqlite_mattn
+
+package whatsappclient
+
+// The cgo driver, for platforms where the pure-Go one misbehaves. Build with
+//
+//	go get github.com/mattn/go-sqlite3
+//	go build -tags "sqlite_mattn sqlite_fts5"
+//
+// and select it with DBOptions.Driver (--db-driver mattn). sqlite_fts5
+// builds in the FTS5 module the message store's search index needs.
+import _ "github.com/mattn/go-sqlite3"
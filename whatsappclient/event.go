@@ -0,0 +1,114 @@
+package whatsappclient
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Message types reported in Event.Type.
+const (
+	TypeText        = "text"
+	TypeImage       = "image"
+	TypeVideo       = "video"
+	TypeDocument    = "document"
+	TypeAudio       = "audio"
+	TypeVoice       = "voice"
+	TypeSticker     = "sticker"
+	TypeLocation    = "location"
+	TypeReaction    = "reaction"
+	TypeButtons     = "buttons"
+	TypeButtonReply = "button_reply"
+	TypeContact     = "contact"
+	TypeUnknown     = "unknown"
+)
+
+// MessageTypes lists every value Event.Type can have.
+var MessageTypes = []string{
+	TypeText, TypeImage, TypeVideo, TypeDocument, TypeAudio, TypeVoice, TypeSticker,
+	TypeLocation, TypeReaction, TypeButtons, TypeButtonReply, TypeContact, TypeUnknown,
+}
+
+// Event is a received message reduced to the fields the CLI displays.
+type Event struct {
+	ID         string    `json:"id"`
+	Chat       types.JID `json:"chat"`
+	Sender     types.JID `json:"sender"`
+	SenderName string    `json:"sender_name"`
+	IsFromMe   bool      `json:"is_from_me"`
+	IsGroup    bool      `json:"is_group"`
+	Timestamp  time.Time `json:"timestamp"`
+	Type       string    `json:"type"`
+	Content    string    `json:"content"`
+
+	// Raw is the original whatsmeow event.
+	Raw *events.Message `json:"-"`
+}
+
+// NewEvent converts a whatsmeow message event into an Event.
+func NewEvent(v *events.Message) Event {
+	msgType, content := ExtractContent(v.Message)
+
+	return Event{
+		ID:         v.Info.ID,
+		Chat:       v.Info.Chat,
+		Sender:     v.Info.Sender,
+		SenderName: v.Info.PushName,
+		IsFromMe:   v.Info.IsFromMe,
+		IsGroup:    v.Info.Chat.Server == types.GroupServer,
+		Timestamp:  v.Info.Timestamp,
+		Type:       msgType,
+		Content:    content,
+		Raw:        v,
+	}
+}
+
+// ExtractContent returns the message type and a human-readable description
+// of its content.
+func ExtractContent(msg *waE2E.Message) (string, string) {
+	if msg.GetConversation() != "" {
+		return TypeText, msg.GetConversation()
+	} else if msg.GetExtendedTextMessage() != nil {
+		return TypeText, msg.GetExtendedTextMessage().GetText()
+	} else if img := msg.GetImageMessage(); img != nil {
+		return TypeImage, fmt.Sprintf("[Image] Caption: %s", img.GetCaption())
+	} else if video := msg.GetVideoMessage(); video != nil {
+		return TypeVideo, fmt.Sprintf("[Video] Caption: %s", video.GetCaption())
+	} else if doc := msg.GetDocumentMessage(); doc != nil {
+		return TypeDocument, fmt.Sprintf("[Document] Filename: %s", doc.GetFileName())
+	} else if audio := msg.GetAudioMessage(); audio != nil {
+		if audio.GetPTT() {
+			return TypeVoice, "[Voice Message]"
+		}
+		return TypeAudio, "[Audio]"
+	} else if msg.GetStickerMessage() != nil {
+		return TypeSticker, "[Sticker]"
+	} else if loc := msg.GetLocationMessage(); loc != nil {
+		return TypeLocation, fmt.Sprintf("[Location] %f,%f %s %s", loc.GetDegreesLatitude(), loc.GetDegreesLongitude(), loc.GetName(), loc.GetAddress())
+	} else if reaction := msg.GetReactionMessage(); reaction != nil {
+		return TypeReaction, fmt.Sprintf("[Reaction] %s to message: %s", reaction.GetText(), reaction.GetKey().GetId())
+	} else if contact := msg.GetContactMessage(); contact != nil {
+		return TypeContact, fmt.Sprintf("[Contact] %s", contact.GetDisplayName())
+	} else if contacts := msg.GetContactsArrayMessage(); contacts != nil {
+		names := make([]string, 0, len(contacts.GetContacts()))
+		for _, c := range contacts.GetContacts() {
+			names = append(names, c.GetDisplayName())
+		}
+		return TypeContact, fmt.Sprintf("[Contacts] %s", strings.Join(names, ", "))
+	} else if buttons := msg.GetButtonsMessage(); buttons != nil {
+		labels := make([]string, 0, len(buttons.GetButtons()))
+		for _, b := range buttons.GetButtons() {
+			labels = append(labels, b.GetButtonText().GetDisplayText())
+		}
+		return TypeButtons, fmt.Sprintf("[Buttons] %s [%s]", buttons.GetContentText(), strings.Join(labels, " | "))
+	} else if reply := msg.GetButtonsResponseMessage(); reply != nil {
+		return TypeButtonReply, fmt.Sprintf("[Button Reply] %s (button ID: %s)", reply.GetSelectedDisplayText(), reply.GetSelectedButtonID())
+	} else if reply := msg.GetTemplateButtonReplyMessage(); reply != nil {
+		return TypeButtonReply, fmt.Sprintf("[Button Reply] %s (button ID: %s)", reply.GetSelectedDisplayText(), reply.GetSelectedID())
+	}
+	return TypeUnknown, "[Unknown Message Type]"
+}
@@ -0,0 +1,97 @@
+package whatsappclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ErrAlreadyPaired is returned by Login when the session database already
+// holds a paired device.
+var ErrAlreadyPaired = errors.New("device is already paired")
+
+// loginTimeout bounds the wait for the post-pairing reconnect to finish.
+const loginTimeout = 15 * time.Second
+
+// LoginOptions receives progress from Login.
+type LoginOptions struct {
+	// OnCode is called with each QR code to show and how long it is valid.
+	// Returning an error aborts the login with that error.
+	OnCode func(code string, timeout time.Duration) error
+	// OnScanned is called once the phone has scanned a code, before Login
+	// waits for the login to complete. Optional.
+	OnScanned func()
+}
+
+// Login pairs a new device by QR code. It connects, returns once the phone
+// has confirmed the login and the session is saved, and leaves the client
+// connected. Cancelling ctx stops waiting for a scan.
+func (c *Client) Login(ctx context.Context, opts LoginOptions) (types.JID, error) {
+	if c.Store.ID != nil {
+		return types.EmptyJID, ErrAlreadyPaired
+	}
+
+	qrChan, err := c.GetQRChannel(ctx)
+	if err != nil {
+		return types.EmptyJID, fmt.Errorf("failed to get QR channel: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		if c.Proxy != "" {
+			return types.EmptyJID, fmt.Errorf("failed to connect through proxy %s: %v", c.Proxy, err)
+		}
+		return types.EmptyJID, fmt.Errorf("failed to connect: %v", err)
+	}
+
+	for evt := range qrChan {
+		switch evt.Event {
+		case "code":
+			if err := opts.OnCode(evt.Code, evt.Timeout); err != nil {
+				c.Disconnect()
+				return types.EmptyJID, err
+			}
+		case "success":
+			if opts.OnScanned != nil {
+				opts.OnScanned()
+			}
+			return c.waitForLogin(ctx)
+		default:
+			// Every other event ends the QR channel
+			if evt.Error != nil {
+				return types.EmptyJID, fmt.Errorf("login failed (%s): %v", evt.Event, evt.Error)
+			}
+			return types.EmptyJID, fmt.Errorf("login failed: %s", evt.Event)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.EmptyJID, err
+	}
+	return types.EmptyJID, fmt.Errorf("QR channel closed before login completed")
+}
+
+// waitForLogin waits for the reconnect that follows pairing and saves the
+// new session.
+func (c *Client) waitForLogin(ctx context.Context) (types.JID, error) {
+	deadline := time.Now().Add(loginTimeout)
+	for !c.IsLoggedIn() && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return types.EmptyJID, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	if c.Store.ID == nil {
+		return types.EmptyJID, fmt.Errorf("failed to get device ID after login")
+	}
+
+	// Force a store flush to ensure data is written to database
+	if err := c.Store.Save(); err != nil {
+		return types.EmptyJID, fmt.Errorf("failed to save session: %v", err)
+	}
+	c.Registered = true
+	return *c.Store.ID, nil
+}
@@ -0,0 +1,26 @@
+package whatsappclient
+
+import (
+	"context"
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Ping sends the keepalive query whatsmeow pings the server with and waits
+// for the answer. whatsmeow emits no event when its own keepalives succeed,
+// so this is how to tell a quiet connection from a dead one.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.DangerousInternals().SendIQ(whatsmeow.DangerousInfoQuery{
+		Context:   ctx,
+		Namespace: "w:p",
+		Type:      "get",
+		To:        types.ServerJID,
+		Timeout:   whatsmeow.KeepAliveResponseDeadline,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ping the server: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package whatsappclient
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ParseRecipient accepts either a full JID (user@server) or a phone number
+// in international format and returns the JID to send to.
+func ParseRecipient(recipient string) (types.JID, error) {
+	recipient = strings.TrimSpace(recipient)
+	if recipient == "" {
+		return types.JID{}, fmt.Errorf("recipient is empty")
+	}
+
+	if strings.Contains(recipient, "@") {
+		jid, err := types.ParseJID(recipient)
+		if err != nil {
+			return types.JID{}, fmt.Errorf("invalid JID %q: %v", recipient, err)
+		}
+		return jid, nil
+	}
+
+	// Strip the formatting people usually type around phone numbers
+	number := strings.NewReplacer("+", "", " ", "", "-", "", "(", "", ")", "").Replace(recipient)
+	if number == "" {
+		return types.JID{}, fmt.Errorf("invalid phone number %q", recipient)
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return types.JID{}, fmt.Errorf("invalid phone number %q", recipient)
+		}
+	}
+
+	return types.NewJID(number, types.DefaultUserServer), nil
+}
+
+// IsSelf reports whether recipient is one of the tokens ("me", "self") that
+// refer to the logged-in account itself.
+func IsSelf(recipient string) bool {
+	switch strings.ToLower(strings.TrimSpace(recipient)) {
+	case "me", "self":
+		return true
+	}
+	return false
+}
+
+// ValidateRecipient checks recipient without needing a loaded session, so
+// commands can reject bad arguments before connecting.
+func ValidateRecipient(recipient string) error {
+	if IsSelf(recipient) {
+		return nil
+	}
+	_, err := ParseRecipient(recipient)
+	return err
+}
+
+// ResolveRecipient is ParseRecipient plus the "me"/"self" tokens, which
+// resolve to the account's own JID and so need the device store loaded.
+// While connected, phone numbers are also checked with LookupPhone, which
+// rejects numbers not on WhatsApp and maps them to their canonical JID.
+func (c *Client) ResolveRecipient(recipient string) (types.JID, error) {
+	if IsSelf(recipient) {
+		if c.Store.ID == nil {
+			return types.JID{}, fmt.Errorf("cannot resolve %q: not logged in", recipient)
+		}
+		return c.Store.ID.ToNonAD(), nil
+	}
+
+	jid, err := ParseRecipient(recipient)
+	if err != nil || strings.Contains(recipient, "@") || !c.IsLoggedIn() {
+		return jid, err
+	}
+
+	lookup, err := c.LookupPhone(jid.User)
+	if err != nil {
+		return types.JID{}, err
+	}
+	if !lookup.Registered {
+		return types.JID{}, fmt.Errorf("%s: %w", recipient, ErrNotOnWhatsApp)
+	}
+	return lookup.JID, nil
+}
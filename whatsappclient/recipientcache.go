@@ -0,0 +1,141 @@
+package whatsappclient
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// DefaultRecipientCacheTTL is how long a phone number lookup is trusted when
+// Options.RecipientCacheTTL is zero.
+const DefaultRecipientCacheTTL = 7 * 24 * time.Hour
+
+// ErrNotOnWhatsApp is returned for phone numbers that aren't registered.
+var ErrNotOnWhatsApp = errors.New("not on WhatsApp")
+
+// PhoneLookup is the result of checking a phone number with WhatsApp.
+type PhoneLookup struct {
+	Phone      string
+	JID        types.JID
+	Registered bool
+	// Cached is set when the result came from the local cache rather than
+	// a network lookup.
+	Cached    bool
+	CheckedAt time.Time
+}
+
+// recipientCache stores phone number lookups in the session database so
+// repeated sends to the same numbers don't each cost an IsOnWhatsApp query.
+type recipientCache struct {
+	db *sql.DB
+}
+
+func openRecipientCache(dbPath string, opts DBOptions) (*recipientCache, error) {
+	db, err := opts.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recipient cache: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS recipient_cache (
+		phone      TEXT PRIMARY KEY,
+		jid        TEXT NOT NULL,
+		registered INTEGER NOT NULL,
+		checked_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create recipient cache: %v", err)
+	}
+
+	return &recipientCache{db: db}, nil
+}
+
+// get returns the cached lookup for phone if it is newer than ttl.
+func (rc *recipientCache) get(phone string, ttl time.Duration) (*PhoneLookup, error) {
+	var jid string
+	var registered bool
+	var checkedAt int64
+	err := rc.db.QueryRow(`SELECT jid, registered, checked_at FROM recipient_cache WHERE phone = ?`, phone).Scan(&jid, &registered, &checkedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read recipient cache: %v", err)
+	}
+
+	lookup := &PhoneLookup{Phone: phone, Registered: registered, Cached: true, CheckedAt: time.Unix(checkedAt, 0)}
+	if time.Since(lookup.CheckedAt) > ttl {
+		return nil, nil
+	}
+	if lookup.JID, err = types.ParseJID(jid); err != nil {
+		return nil, nil
+	}
+	return lookup, nil
+}
+
+func (rc *recipientCache) put(lookup *PhoneLookup) error {
+	_, err := rc.db.Exec(`INSERT OR REPLACE INTO recipient_cache (phone, jid, registered, checked_at) VALUES (?, ?, ?, ?)`,
+		lookup.Phone, lookup.JID.String(), lookup.Registered, lookup.CheckedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to update recipient cache: %v", err)
+	}
+	return nil
+}
+
+// LookupPhone checks whether a phone number (digits only, with country code)
+// is on WhatsApp and returns its canonical JID, using the local cache unless
+// it is disabled or the entry has expired. The client must be connected on
+// a cache miss.
+func (c *Client) LookupPhone(phone string) (*PhoneLookup, error) {
+	cache, err := c.recipientCache()
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil {
+		if lookup, err := cache.get(phone, c.cacheTTL); err != nil {
+			c.log.Warnf("%v", err)
+		} else if lookup != nil {
+			return lookup, nil
+		}
+	}
+
+	resp, err := c.IsOnWhatsApp([]string{"+" + phone})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %v", phone, err)
+	}
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("failed to look up %s: empty response", phone)
+	}
+
+	lookup := &PhoneLookup{Phone: phone, JID: resp[0].JID, Registered: resp[0].IsIn, CheckedAt: time.Now()}
+	if lookup.JID.IsEmpty() {
+		lookup.JID = types.NewJID(phone, types.DefaultUserServer)
+	}
+	if cache != nil {
+		if err := cache.put(lookup); err != nil {
+			c.log.Warnf("%v", err)
+		}
+	}
+	return lookup, nil
+}
+
+// recipientCache opens the cache on first use. It returns nil when the cache
+// is disabled.
+func (c *Client) recipientCache() (*recipientCache, error) {
+	if c.noCache {
+		return nil, nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cache == nil {
+		cache, err := openRecipientCache(c.DBPath, c.dbOpts)
+		if err != nil {
+			return nil, err
+		}
+		c.cache = cache
+	}
+	return c.cache, nil
+}